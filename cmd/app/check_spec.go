@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hezzl_test/internal/config"
+	"hezzl_test/internal/http-server/openapi"
+	"log/slog"
+	"os"
+)
+
+// runCheckSpec fails when the router serves a route the OpenAPI spec does not document or the other way round,
+// it needs no running dependencies and is meant for CI
+func runCheckSpec(_ context.Context, cfg *config.Config, log *slog.Logger, _ []string) error {
+	const op = "cmd.app.runCheckSpec"
+
+	doc, err := openapi.Load()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	router, err := setupRouter(log, cfg, doc, routeDeps{})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	drift, err := openapi.CheckRoutes(doc, router)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, route := range drift {
+		fmt.Fprintln(os.Stdout, route)
+	}
+
+	if len(drift) > 0 {
+		return fmt.Errorf("%s: %d routes differ from the spec", op, len(drift))
+	}
+
+	log.Info("routes match the OpenAPI spec")
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hezzl_test/internal/config"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// command is a one-shot subcommand of the app binary, e.g. `app export -format csv`
+type command func(ctx context.Context, cfg *config.Config, log *slog.Logger, args []string) error
+
+var commands = map[string]command{
+	"check-spec":     runCheckSpec,
+	"export":         runExport,
+	"migrate-events": runMigrateEvents,
+	"reconcile":      runReconcile,
+	"rebuild-index":  runRebuildIndex,
+	"warmup":         runWarmup,
+}
+
+func runCommand(cfg *config.Config, log *slog.Logger, name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		return fmt.Errorf("unknown command %q, available: %s", name, strings.Join(names, ", "))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return cmd(ctx, cfg, log, args)
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/config"
+	"hezzl_test/internal/entity"
+	"hezzl_test/internal/http-server/openapi"
+	"hezzl_test/internal/sink"
+	"hezzl_test/internal/storage/postgres"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubStorage answers every read with goods of project 1 and lets every write succeed
+type stubStorage struct{}
+
+var stubCreatedAt = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func stubGood(id int) entity.GoodsForList {
+	return entity.GoodsForList{
+		Id:          id,
+		ProjectId:   1,
+		Name:        "good",
+		Description: "description",
+		Priority:    id,
+		CreatedAt:   stubCreatedAt,
+		GoodLabels: entity.GoodLabels{
+			Tags:       []string{"red"},
+			Attributes: map[string]any{"size": 42.0},
+		},
+	}
+}
+
+func (stubStorage) CreateGood(projectId int, name string, labels entity.GoodLabels) (entity.GoodCreateResponse, error) {
+	good := stubGood(1)
+	return entity.GoodCreateResponse{
+		Id:         good.Id,
+		ProjectId:  projectId,
+		Name:       name,
+		Priority:   good.Priority,
+		CreatedAt:  good.CreatedAt,
+		GoodLabels: good.GoodLabels,
+	}, nil
+}
+
+func (stubStorage) UpdateGood(id, projectId int, name, description string, labels entity.GoodLabels) (entity.GoodUpdateResponse, error) {
+	good := stubGood(id)
+	return entity.GoodUpdateResponse{
+		Id:          id,
+		ProjectId:   projectId,
+		Name:        name,
+		Description: description,
+		Priority:    good.Priority,
+		CreatedAt:   good.CreatedAt,
+		GoodLabels:  good.GoodLabels,
+	}, nil
+}
+
+func (stubStorage) PatchGood(id, projectId int, apply func(entity.GoodDocument) (entity.GoodDocument, error)) (entity.GoodDocument, entity.GoodDocument, error) {
+	good := stubGood(id)
+	before := entity.GoodDocument{
+		Id:          id,
+		ProjectId:   projectId,
+		Name:        &good.Name,
+		Description: &good.Description,
+		Priority:    good.Priority,
+		CreatedAt:   good.CreatedAt,
+		GoodLabels:  good.GoodLabels,
+	}
+
+	after, err := apply(before)
+
+	return before, after, err
+}
+
+func (stubStorage) DeleteGood(id, projectId int) (entity.GoodRemoveResponse, string, string, int, entity.GoodLabels, error) {
+	good := stubGood(id)
+	return entity.GoodRemoveResponse{Id: id, ProjectId: projectId, Removed: true}, good.Name, good.Description, good.Priority, good.GoodLabels, nil
+}
+
+func (stubStorage) GetGoodByID(key int) (entity.GoodsForList, error) {
+	return stubGood(key), nil
+}
+
+func (stubStorage) GetGoodsByIDs(ids []int) ([]entity.GoodsForList, error) {
+	goods := make([]entity.GoodsForList, len(ids))
+	for i, id := range ids {
+		goods[i] = stubGood(id)
+	}
+	return goods, nil
+}
+
+func (stubStorage) ListGoodIDs(projectId int, removed *bool, limit, offset int) ([]int, error) {
+	return []int{1, 2}, nil
+}
+
+func (stubStorage) FilterGoodIDs(projectId int, removed *bool, filter entity.GoodsFilter, limit, offset int) ([]int, error) {
+	return []int{1, 2}, nil
+}
+
+func (stubStorage) ProjectStats(projectId int) (entity.ProjectStats, error) {
+	return entity.ProjectStats{ProjectId: projectId, Total: 2, Active: 2}, nil
+}
+
+func (stubStorage) Reprioritize(goodID, projectID, newPriority int) (string, string, entity.GoodLabels, error) {
+	good := stubGood(goodID)
+	return good.Name, good.Description, good.GoodLabels, nil
+}
+
+func (stubStorage) MoveGood(id, projectId, newProjectId int) (entity.GoodsForList, error) {
+	good := stubGood(id)
+	good.ProjectId = newProjectId
+	return good, nil
+}
+
+func (stubStorage) ListProjects(limit, offset int) ([]entity.Project, error) {
+	return []entity.Project{{Id: 1, Name: "project", CreatedAt: stubCreatedAt}}, nil
+}
+
+func (stubStorage) GetProjectsByIDs(ids []int) ([]entity.Project, error) {
+	projects := make([]entity.Project, len(ids))
+	for i, id := range ids {
+		projects[i] = entity.Project{Id: id, Name: "project", CreatedAt: stubCreatedAt}
+	}
+	return projects, nil
+}
+
+func (s stubStorage) ProjectStatsByIDs(ids []int) (map[int]entity.ProjectStats, error) {
+	stats := make(map[int]entity.ProjectStats, len(ids))
+	for _, id := range ids {
+		stats[id], _ = s.ProjectStats(id)
+	}
+	return stats, nil
+}
+
+func (stubStorage) ListGoodIDsByProjects(projectIds []int, removed *bool, limit, offset int) (map[int][]int, error) {
+	ids := make(map[int][]int, len(projectIds))
+	for _, id := range projectIds {
+		ids[id] = []int{1, 2}
+	}
+	return ids, nil
+}
+
+func (stubStorage) SearchGoods(projectId int, query string, limit, offset int) ([]entity.GoodSearchResult, error) {
+	good := stubGood(1)
+	return []entity.GoodSearchResult{{
+		GoodsForList: good,
+		Rank:         0.5,
+		Highlight:    entity.SearchHighlight{Name: postgres.HighlightStart + good.Name + postgres.HighlightStop, Description: good.Description},
+	}}, nil
+}
+
+func (stubStorage) SuggestGoods(projectId int, prefix string, limit int) ([]entity.GoodSuggestion, error) {
+	return []entity.GoodSuggestion{{Id: 1, ProjectId: 1, Name: "good", Priority: 1}}, nil
+}
+
+func (stubStorage) Batch(ops []entity.BatchOperation, atomic bool) ([]postgres.BatchResult, error) {
+	results := make([]postgres.BatchResult, len(ops))
+	for i := range ops {
+		results[i] = postgres.BatchResult{Good: stubGood(i + 1)}
+	}
+	return results, nil
+}
+
+type stubSinks struct{}
+
+func (stubSinks) Health(context.Context) []sink.Health {
+	return []sink.Health{{Name: "stdout", Status: sink.StatusOK, Written: 1, LastSuccess: stubCreatedAt}}
+}
+
+// contractRouter is the router of the app in front of the stubs, with request validation on
+func contractRouter(t *testing.T) (*openapi3.T, http.Handler) {
+	t.Helper()
+
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+
+	cfg := &config.Config{
+		OpenAPI: config.OpenAPI{ValidateRequests: true},
+		Admin:   config.Admin{Token: "secret"},
+		Warmup:  config.Warmup{Pages: 1, PageSize: 10, Concurrency: 1},
+	}
+
+	router, err := setupRouter(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, doc, routeDeps{
+		storage:    stubStorage{},
+		goodsCache: cache.NewLRU(1000),
+		sinks:      stubSinks{},
+	})
+	if err != nil {
+		t.Fatalf("setup router: %v", err)
+	}
+
+	return doc, router
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+
+	router, err := setupRouter(slog.New(slog.NewTextHandler(io.Discard, nil)), &config.Config{}, doc, routeDeps{})
+	if err != nil {
+		t.Fatalf("setup router: %v", err)
+	}
+
+	drift, err := openapi.CheckRoutes(doc, router)
+	if err != nil {
+		t.Fatalf("check routes: %v", err)
+	}
+	for _, route := range drift {
+		t.Errorf("route differs from the spec: %s", route)
+	}
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	doc, router := contractRouter(t)
+
+	specRouter, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("spec router: %v", err)
+	}
+
+	const (
+		good  = `{"name": "good", "tags": ["Red"], "attributes": {"size": 42}}`
+		graph = `{"query": "{ projects { id name goods(limit: 1) { limit items { id name tags attributes } } } }"}`
+		batch = `{"operations": [{"op": "create", "projectId": 1, "name": "good"}, {"op": "reprioritize", "ref": 0, "newPriority": 1}]}`
+	)
+
+	// one request per documented operation, keyed by the operation as the spec names it
+	cases := map[string]struct {
+		path        string
+		body        string
+		contentType string
+		status      int
+	}{
+		"POST /good/create/{projectId}":             {path: "/good/create/1", body: good, status: http.StatusCreated},
+		"PATCH /good/update/{id}/{projectId}":       {path: "/good/update/1/1", body: good, status: http.StatusOK},
+		"DELETE /good/remove/{id}/{projectId}":      {path: "/good/remove/1/1", status: http.StatusOK},
+		"GET /goods/list":                           {path: "/goods/list?projectId=1&tag=red&attr.size=42", status: http.StatusOK},
+		"GET /goods/search":                         {path: "/goods/search?q=good&projectId=1", status: http.StatusOK},
+		"GET /goods/suggest":                        {path: "/goods/suggest?prefix=go&projectId=1", status: http.StatusOK},
+		"PATCH /good/reprioritize/{id}/{projectId}": {path: "/good/reprioritize/1/1", body: `{"newPriority": 2}`, status: http.StatusOK},
+		"PATCH /good/move/{id}/{projectId}":         {path: "/good/move/1/1", body: `{"newProjectId": 2}`, status: http.StatusOK},
+
+		"POST /v1/good/create/{projectId}":             {path: "/v1/good/create/1", body: good, status: http.StatusCreated},
+		"PATCH /v1/good/update/{id}/{projectId}":       {path: "/v1/good/update/1/1", body: `{"name": "patched"}`, contentType: "application/merge-patch+json", status: http.StatusOK},
+		"DELETE /v1/good/remove/{id}/{projectId}":      {path: "/v1/good/remove/1/1", status: http.StatusOK},
+		"GET /v1/goods/list":                           {path: "/v1/goods/list", status: http.StatusOK},
+		"GET /v1/goods/search":                         {path: "/v1/goods/search?q=good", status: http.StatusOK},
+		"GET /v1/goods/suggest":                        {path: "/v1/goods/suggest?prefix=go", status: http.StatusOK},
+		"PATCH /v1/good/reprioritize/{id}/{projectId}": {path: "/v1/good/reprioritize/1/1", body: `{"newPriority": 2}`, status: http.StatusOK},
+		"PATCH /v1/good/move/{id}/{projectId}":         {path: "/v1/good/move/1/1", body: `{"newProjectId": 2}`, status: http.StatusOK},
+
+		"GET /v2/goods":                                    {path: "/v2/goods?removed=false", status: http.StatusOK},
+		"GET /v2/goods/search":                             {path: "/v2/goods/search?q=good", status: http.StatusOK},
+		"GET /v2/goods/suggest":                            {path: "/v2/goods/suggest?prefix=go", status: http.StatusOK},
+		"GET /v2/projects/{projectId}/goods":               {path: "/v2/projects/1/goods?tag=red", status: http.StatusOK},
+		"POST /v2/projects/{projectId}/goods":              {path: "/v2/projects/1/goods", body: good, status: http.StatusCreated},
+		"GET /v2/projects/{projectId}/goods/search":        {path: "/v2/projects/1/goods/search?q=good", status: http.StatusOK},
+		"GET /v2/projects/{projectId}/goods/suggest":       {path: "/v2/projects/1/goods/suggest?prefix=go", status: http.StatusOK},
+		"GET /v2/projects/{projectId}/goods/{id}":          {path: "/v2/projects/1/goods/1", status: http.StatusOK},
+		"PATCH /v2/projects/{projectId}/goods/{id}":        {path: "/v2/projects/1/goods/1", body: `[{"op": "replace", "path": "/name", "value": "patched"}]`, contentType: "application/json-patch+json", status: http.StatusOK},
+		"DELETE /v2/projects/{projectId}/goods/{id}":       {path: "/v2/projects/1/goods/1", status: http.StatusNoContent},
+		"PUT /v2/projects/{projectId}/goods/{id}/priority": {path: "/v2/projects/1/goods/1/priority", body: `{"newPriority": 2}`, status: http.StatusOK},
+		"POST /v2/projects/{projectId}/goods/{id}/move":    {path: "/v2/projects/1/goods/1/move", body: `{"newProjectId": 2}`, status: http.StatusOK},
+
+		"POST /batch":              {path: "/batch", body: batch, status: http.StatusOK},
+		"POST /graphql":            {path: "/graphql", body: graph, status: http.StatusOK},
+		"GET /health/sinks":        {path: "/health/sinks", status: http.StatusOK},
+		"POST /admin/cache/warmup": {path: "/admin/cache/warmup", body: `{"projects": [1]}`, status: http.StatusAccepted},
+		"GET /admin/cache/warmup":  {path: "/admin/cache/warmup", status: http.StatusOK},
+		"GET /openapi.json":        {path: "/openapi.json", status: http.StatusOK},
+		"GET /swagger":             {path: "/swagger", status: http.StatusOK},
+		"GET /metrics":             {path: "/metrics", status: http.StatusOK},
+	}
+
+	documented := make(map[string]bool)
+	for _, path := range doc.Paths.InMatchingOrder() {
+		for method := range doc.Paths.Value(path).Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+	for operation := range documented {
+		if _, ok := cases[operation]; !ok {
+			t.Errorf("%s is documented but has no contract case", operation)
+		}
+	}
+
+	for operation, c := range cases {
+		t.Run(operation, func(t *testing.T) {
+			if !documented[operation] {
+				t.Fatalf("%s is not documented", operation)
+			}
+
+			method, _, _ := strings.Cut(operation, " ")
+
+			req := httptest.NewRequest(method, c.path, strings.NewReader(c.body))
+			if c.body != "" {
+				contentType := c.contentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				req.Header.Set("Content-Type", contentType)
+			}
+			if strings.HasPrefix(c.path, "/admin") {
+				req.Header.Set("Authorization", "Bearer secret")
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, c.status, rec.Body.String())
+			}
+			// GraphQL answers errors with 200
+			if c.path == "/graphql" && strings.Contains(rec.Body.String(), `"errors"`) {
+				t.Fatalf("errors in the response: %s", rec.Body.String())
+			}
+
+			route, pathParams, err := specRouter.FindRoute(httptest.NewRequest(method, c.path, nil))
+			if err != nil {
+				t.Fatalf("find route: %v", err)
+			}
+
+			// only JSON bodies are checked against schemas, the others just have to be documented
+			jsonBody := strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json")
+
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{
+					Request:    req,
+					PathParams: pathParams,
+					Route:      route,
+				},
+				Status:  rec.Code,
+				Header:  rec.Header(),
+				Body:    io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+				Options: &openapi3filter.Options{IncludeResponseStatus: true, ExcludeResponseBody: !jsonBody},
+			})
+			if err != nil {
+				t.Errorf("response does not match the spec: %v\n%s", err, rec.Body.String())
+			}
+		})
+	}
+}
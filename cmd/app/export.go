@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"hezzl_test/internal/config"
+	"hezzl_test/internal/export"
+	"hezzl_test/internal/storage/clickhouse"
+	"log/slog"
+	"time"
+)
+
+func runExport(ctx context.Context, cfg *config.Config, log *slog.Logger, args []string) error {
+	const op = "cmd.app.runExport"
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	projectId := fs.Int("project", 0, "project id, 0 exports every project")
+	from := fs.String("from", "", "start of the time range (RFC3339), inclusive")
+	to := fs.String("to", "", "end of the time range (RFC3339), exclusive")
+	format := fs.String("format", export.FormatNDJSON, "output format: ndjson, csv or parquet")
+	out := fs.String("out", "", "output file path, defaults to events.<format>")
+	chunkSize := fs.Int("chunk-size", 10000, "number of events written per chunk")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	filter := clickhouse.EventFilter{ProjectId: *projectId}
+
+	var err error
+	if *from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, *from); err != nil {
+			return fmt.Errorf("%s: invalid -from: %w", op, err)
+		}
+	}
+	if *to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fmt.Errorf("%s: invalid -to: %w", op, err)
+		}
+	}
+
+	path := *out
+	if path == "" {
+		path = "events." + *format
+	}
+
+	chDB, err := clickhouse.SetupClickHouseConnection(
+		cfg.ClickHouse.Host,
+		cfg.ClickHouse.Port,
+		cfg.ClickHouse.User,
+		cfg.ClickHouse.Password,
+		cfg.ClickHouse.DBName,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer chDB.Close()
+
+	log.Info("export started",
+		slog.String("format", *format),
+		slog.String("path", path),
+		slog.Int("project_id", *projectId),
+	)
+
+	total, err := export.Run(ctx, log, chDB, export.Options{
+		Filter:    filter,
+		Format:    *format,
+		Path:      path,
+		ChunkSize: *chunkSize,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("export finished", slog.Int("events", total), slog.String("path", path))
+
+	return nil
+}
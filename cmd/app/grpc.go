@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	goodsv1 "hezzl_test/api/goods/v1"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/config"
+	grpcgoods "hezzl_test/internal/grpc-server/goods"
+	grpclogger "hezzl_test/internal/grpc-server/middleware/logger"
+	grpcratelimit "hezzl_test/internal/grpc-server/middleware/ratelimit"
+	"hezzl_test/internal/http-server/middleware/ratelimit"
+	"hezzl_test/internal/lib/logger/sl"
+	"hezzl_test/internal/storage/postgres"
+	"log/slog"
+	"net"
+)
+
+// startGRPCServer serves the gRPC API in the background, it shares the storage, cache and NATS connection with the HTTP server
+// and counts calls in the rate limit windows of the HTTP API
+func startGRPCServer(log *slog.Logger, cfg config.GRPCServer, rateLimit config.RateLimit, storage *postgres.Storage, goodsCache cache.Cache, natsConn *nats.Conn, redisClient *redis.Client) (*grpc.Server, error) {
+	const op = "cmd.app.startGRPCServer"
+
+	lis, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	limiter := grpcratelimit.New(log, ratelimit.New(log, redisClient, rateLimitOptions(rateLimit)), rateLimit.ClientHeader)
+
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpclogger.Unary(log), limiter.Unary()),
+		grpc.ChainStreamInterceptor(grpclogger.Stream(log), limiter.Stream()),
+	)
+
+	goodsv1.RegisterGoodsServiceServer(srv, grpcgoods.New(log, storage, goodsCache, natsConn))
+
+	if cfg.Reflection {
+		reflection.Register(srv)
+	}
+
+	go func() {
+		log.Info("starting gRPC server", slog.String("address", cfg.Address))
+
+		if err := srv.Serve(lis); err != nil {
+			log.Error("gRPC server stopped", sl.Err(err))
+		}
+	}()
+
+	return srv, nil
+}
@@ -1,25 +1,33 @@
 package main
 
 import (
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	"context"
+	"errors"
 	"github.com/nats-io/nats.go"
 	"github.com/redis/go-redis/v9"
-	"github.com/rs/cors"
+	"hezzl_test/internal/cache"
 	"hezzl_test/internal/config"
-	"hezzl_test/internal/http-server/handlers/goods"
-	"hezzl_test/internal/http-server/middleware/logger"
+	"hezzl_test/internal/http-server/middleware/ratelimit"
+	"hezzl_test/internal/http-server/openapi"
+	"hezzl_test/internal/lib/logger/sl"
 	natss "hezzl_test/internal/nats"
+	"hezzl_test/internal/spool"
 	"hezzl_test/internal/storage/clickhouse"
 	"hezzl_test/internal/storage/postgres"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 const (
 	envDev  = "dev"
 	envProd = "prod"
+
+	// shutdownTimeout bounds how long in-flight requests may finish after SIGTERM
+	shutdownTimeout = 10 * time.Second
 )
 
 func main() {
@@ -27,6 +35,14 @@ func main() {
 
 	log := SetupLogger(cfg.Env)
 
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, log, os.Args[1], os.Args[2:]); err != nil {
+			log.Error("command failed", slog.String("command", os.Args[1]), sl.Err(err))
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Info("App started", slog.String("env", cfg.Env))
 	log.Debug("Debugging started")
 
@@ -38,12 +54,23 @@ func main() {
 		cfg.Postgres.DBName,
 	)
 	if err != nil {
-		log.Error("failed to init storage: ", err)
+		log.Error("failed to init storage", sl.Err(err))
 		os.Exit(1)
 	}
 
 	log.Info("Loaded configuration", slog.Any("config", cfg))
 
+	setupQuotas(storage, cfg.Quotas)
+
+	eventSpool, err := spool.New(cfg.Spool.Dir, cfg.Spool.MaxFileSize)
+	if err != nil {
+		log.Error("failed to init event spool", sl.Err(err))
+		os.Exit(1)
+	}
+	defer eventSpool.Close()
+
+	clickhouse.SetSpool(eventSpool)
+
 	chDB, err := clickhouse.SetupClickHouseConnection(
 		cfg.ClickHouse.Host,
 		cfg.ClickHouse.Port,
@@ -52,20 +79,29 @@ func main() {
 		cfg.ClickHouse.DBName,
 	)
 	if err != nil {
-		log.Error("Error initializing ClickHouse connection: ", err)
-		os.Exit(1)
-	}
+		log.Warn("ClickHouse is unavailable, events will be spooled to disk", sl.Err(err))
 
-	clickTable := clickhouse.CreateTableClickHouse(chDB)
-	if err != nil {
-		log.Error("failed create ClickHouse table: ", err)
+		go clickhouse.KeepConnecting(
+			cfg.ClickHouse.Host,
+			cfg.ClickHouse.Port,
+			cfg.ClickHouse.User,
+			cfg.ClickHouse.Password,
+			cfg.ClickHouse.DBName,
+			cfg.Spool.ReconnectInterval,
+		)
+	} else {
+		if err := clickhouse.CreateTableClickHouse(chDB); err != nil {
+			log.Error("failed create ClickHouse table", sl.Err(err))
+		}
+		defer chDB.Close()
 	}
-	_ = clickTable
-	defer chDB.Close()
 
-	natsConn, err := nats.Connect(nats.DefaultURL)
+	natsClosed := make(chan struct{})
+	natsConn, err := nats.Connect(nats.DefaultURL, nats.ClosedHandler(func(*nats.Conn) {
+		close(natsClosed)
+	}))
 	if err != nil {
-		log.Error("Error connecting to NATS: ", err)
+		log.Error("Error connecting to NATS", sl.Err(err))
 		os.Exit(1)
 	}
 
@@ -74,36 +110,67 @@ func main() {
 		Password: cfg.Redis.Password,
 		DB:       cfg.Redis.DB,
 	})
+	defer redisClient.Close()
+
+	goodsCache := setupCache(cfg.Cache, redisClient)
 
-	err = natss.SubscribeToNATSEvents(natsConn, chDB)
+	sinks, err := setupSinks(log, cfg.Sinks, redisClient)
+	if err != nil {
+		log.Error("failed to setup event sinks", sl.Err(err))
+		os.Exit(1)
+	}
+
+	// the sinks are stopped once NATS delivered its last events to them, they flush their batches before Run returns
+	sinksCtx, stopSinks := context.WithCancel(context.Background())
+	sinksDone := make(chan struct{})
+	go func() {
+		defer close(sinksDone)
+		sinks.Run(sinksCtx)
+	}()
+	go clickhouse.StartBackfill(cfg.Spool.BackfillInterval)
+
+	err = natss.SubscribeToNATSEvents(log, natsConn, sinks)
+	if err != nil {
+		log.Error("failed to subscribe to NATS events", sl.Err(err))
+		os.Exit(1)
+	}
 
-	go clickhouse.StartFlusher()
+	if tiered, ok := goodsCache.(*cache.Tiered); ok {
+		if err := natss.SubscribeToInvalidations(log, natsConn, tiered.Local()); err != nil {
+			log.Error("failed to subscribe to cache invalidations", sl.Err(err))
+			os.Exit(1)
+		}
+	}
 
 	log.Info("storage successfully initialized")
 
-	router := chi.NewRouter()
+	doc, err := openapi.Load()
+	if err != nil {
+		log.Error("failed to load OpenAPI spec", sl.Err(err))
+		os.Exit(1)
+	}
 
-	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "DELETE", "PUT", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
+	router, err := setupRouter(log, cfg, doc, routeDeps{
+		storage:     storage,
+		goodsCache:  goodsCache,
+		natsConn:    natsConn,
+		redisClient: redisClient,
+		sinks:       sinks,
 	})
+	if err != nil {
+		log.Error("failed to setup router", sl.Err(err))
+		os.Exit(1)
+	}
 
-	router.Use(middleware.RequestID)
-	router.Use(middleware.Logger)
-	router.Use(logger.New(log))
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
-	router.Use(corsHandler.Handler)
+	if drift, err := openapi.CheckRoutes(doc, router); err != nil || len(drift) > 0 {
+		log.Error("routes and OpenAPI spec differ", slog.Any("drift", drift), sl.Err(err))
+	}
 
-	router.Post("/good/create/{projectId}", goods.Create(log, storage, natsConn))
-	router.Patch("/good/update/{id}/{projectId}", goods.Update(log, storage, redisClient, natsConn))
-	router.Delete("/good/remove/{id}/{projectId}", goods.Remove(log, storage, redisClient, natsConn))
-	router.Get("/goods/list", goods.List(log, storage, redisClient))
-	router.Patch("/good/reprioritize/{id}/{projectId}", goods.Reprioritize(log, storage, redisClient, natsConn))
+	grpcServer, err := startGRPCServer(log, cfg.GRPCServer, cfg.RateLimit, storage, goodsCache, natsConn, redisClient)
+	if err != nil {
+		log.Error("failed to start gRPC server", sl.Err(err))
+		os.Exit(1)
+	}
 
 	log.Info("starting server", slog.String("address", cfg.HTTPServer.Address))
 
@@ -115,11 +182,89 @@ func main() {
 		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
 	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start server", sl.Err(err))
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to shut down server", sl.Err(err))
+	}
+
+	// watch streams never end by themselves, they are cut once the timeout is over
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		grpcServer.Stop()
+	}
+
+	// draining hands the events already received to the sinks and closes the connection
+	if err := natsConn.Drain(); err != nil {
+		log.Error("failed to drain NATS connection", sl.Err(err))
+		natsConn.Close()
+	}
+	<-natsClosed
+
+	stopSinks()
+	<-sinksDone
+
+	log.Info("server stopped")
+}
+
+// setupCache puts the in-process tier in front of Redis unless it is disabled
+func setupCache(cfg config.Cache, redisClient *redis.Client) cache.Cache {
+	remote := cache.NewRedis(redisClient, cache.NewBreaker(cfg.BreakerFailures, cfg.BreakerCooldown))
+	if cfg.LocalSize <= 0 {
+		return remote
+	}
+
+	return cache.NewTiered(cache.NewLRU(cfg.LocalSize), remote, cfg.LocalTTL)
+}
+
+// setupQuotas hands the configured project quotas to the storage, which enforces them
+func setupQuotas(storage *postgres.Storage, cfg config.Quotas) {
+	projects := make(map[int]postgres.Quota, len(cfg.Projects))
+	for projectId, quota := range cfg.Projects {
+		projects[projectId] = postgres.Quota(quota)
+	}
+
+	storage.SetQuotas(postgres.Quota(cfg.Default), projects)
+}
+
+func rateLimitOptions(cfg config.RateLimit) ratelimit.Options {
+	opts := ratelimit.Options{
+		ClientHeader: cfg.ClientHeader,
+		ClientKeys:   cfg.ClientKeys,
+		Client:       ratelimit.Limit(cfg.Client),
+		Project:      ratelimit.Limit(cfg.Project),
+	}
+
+	for _, route := range cfg.Routes {
+		opts.Routes = append(opts.Routes, ratelimit.Route{
+			Name:    route.Name,
+			Method:  route.Method,
+			Pattern: route.Pattern,
+			Limit:   ratelimit.Limit(route.RateLimitWindow),
+		})
 	}
 
-	log.Error("server stopped")
+	return opts
 }
 
 func SetupLogger(env string) *slog.Logger {
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hezzl_test/internal/config"
+	"hezzl_test/internal/storage/clickhouse"
+	"log/slog"
+)
+
+// runMigrateEvents moves an events table created before it was a ReplacingMergeTree to the current schema,
+// the app must be stopped while it runs
+func runMigrateEvents(ctx context.Context, cfg *config.Config, log *slog.Logger, args []string) error {
+	const op = "cmd.app.runMigrateEvents"
+
+	chDB, err := clickhouse.SetupClickHouseConnection(
+		cfg.ClickHouse.Host,
+		cfg.ClickHouse.Port,
+		cfg.ClickHouse.User,
+		cfg.ClickHouse.Password,
+		cfg.ClickHouse.DBName,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer chDB.Close()
+
+	// the old table gets the columns added since first, so it can be copied column by column
+	if err := clickhouse.CreateTableClickHouse(chDB); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	migrated, err := clickhouse.MigrateEventsTable(ctx, chDB)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !migrated {
+		log.Info("events table is up to date")
+		return nil
+	}
+
+	log.Info("events table migrated, the old one is kept as events_before_migration")
+
+	return nil
+}
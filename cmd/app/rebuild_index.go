@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/config"
+	"hezzl_test/internal/entity"
+	"hezzl_test/internal/storage/postgres"
+	"log/slog"
+)
+
+func runRebuildIndex(ctx context.Context, cfg *config.Config, log *slog.Logger, args []string) error {
+	const op = "cmd.app.runRebuildIndex"
+
+	fs := flag.NewFlagSet("rebuild-index", flag.ContinueOnError)
+	projectId := fs.Int("project", 0, "project id, 0 rebuilds every project")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	storage, err := postgres.New(
+		cfg.Postgres.Host,
+		cfg.Postgres.Port,
+		cfg.Postgres.User,
+		cfg.Postgres.Password,
+		cfg.Postgres.DBName,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Address,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	defer redisClient.Close()
+
+	goodsList, err := storage.ListAllGoods(*projectId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	projects := make(map[int]bool)
+	if *projectId != 0 {
+		projects[*projectId] = true
+	}
+	for _, good := range goodsList {
+		projects[good.ProjectId] = true
+	}
+
+	index := cache.NewRankIndex(redisClient)
+	for project := range projects {
+		// every attempt loads the goods again, the list above may be older than the events applied meanwhile
+		n, err := index.Rebuild(ctx, project, func() ([]entity.GoodsForList, error) {
+			return storage.ListAllGoods(project)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: project %d: %w", op, project, err)
+		}
+
+		log.Info("rank index rebuilt", slog.Int("project_id", project), slog.Int("goods", n))
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"hezzl_test/internal/config"
+	"hezzl_test/internal/entity"
+	natss "hezzl_test/internal/nats"
+	"hezzl_test/internal/reconcile"
+	"hezzl_test/internal/storage/clickhouse"
+	"hezzl_test/internal/storage/postgres"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+)
+
+func runReconcile(ctx context.Context, cfg *config.Config, log *slog.Logger, args []string) error {
+	const op = "cmd.app.runReconcile"
+
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	projectId := fs.Int("project", 0, "project id, 0 checks every project")
+	repair := fs.Bool("repair", false, "publish correction events for every good that drifted")
+	format := fs.String("format", "text", "report format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	storage, err := postgres.New(
+		cfg.Postgres.Host,
+		cfg.Postgres.Port,
+		cfg.Postgres.User,
+		cfg.Postgres.Password,
+		cfg.Postgres.DBName,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	chDB, err := clickhouse.SetupClickHouseConnection(
+		cfg.ClickHouse.Host,
+		cfg.ClickHouse.Port,
+		cfg.ClickHouse.User,
+		cfg.ClickHouse.Password,
+		cfg.ClickHouse.DBName,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer chDB.Close()
+
+	goodsList, err := storage.ListAllGoods(*projectId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	latest, err := clickhouse.LatestEvents(ctx, chDB, *projectId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	discrepancies := reconcile.Compare(goodsList, latest)
+
+	if err := printDiscrepancies(*format, discrepancies); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("reconcile finished",
+		slog.Int("goods", len(goodsList)),
+		slog.Int("discrepancies", len(discrepancies)),
+	)
+
+	if !*repair || len(discrepancies) == 0 {
+		return nil
+	}
+
+	natsConn, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer natsConn.Close()
+
+	corrections := reconcile.Corrections(discrepancies)
+	for _, event := range corrections {
+		if err := natss.PublishEvent(natsConn, &event); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := natsConn.Flush(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("correction events published", slog.Int("events", len(corrections)))
+
+	return nil
+}
+
+func printDiscrepancies(format string, discrepancies []reconcile.Discrepancy) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		for _, d := range discrepancies {
+			if err := enc.Encode(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "text":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "GOOD\tPROJECT\tKIND\tPOSTGRES\tCLICKHOUSE")
+		for _, d := range discrepancies {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\n", d.GoodId, d.ProjectId, d.Kind, describe(d.Kind, d.Expected), describe(d.Kind, d.Actual))
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+func describe(kind string, event *entity.GoodEvent) string {
+	if event == nil {
+		return "-"
+	}
+
+	switch kind {
+	case reconcile.KindStalePriority:
+		return fmt.Sprintf("priority=%d", event.Priority)
+	case reconcile.KindWrongRemoved:
+		return fmt.Sprintf("removed=%t", event.Removed)
+	default:
+		return fmt.Sprintf("project=%d name=%q description=%q", event.ProjectId, event.Name, event.Description)
+	}
+}
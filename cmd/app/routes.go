@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/cors"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/config"
+	"hezzl_test/internal/graphql"
+	"hezzl_test/internal/http-server/handlers/admin"
+	"hezzl_test/internal/http-server/handlers/goods"
+	"hezzl_test/internal/http-server/handlers/health"
+	"hezzl_test/internal/http-server/middleware/adminauth"
+	"hezzl_test/internal/http-server/middleware/logger"
+	"hezzl_test/internal/http-server/middleware/metrics"
+	"hezzl_test/internal/http-server/middleware/ratelimit"
+	"hezzl_test/internal/http-server/middleware/version"
+	"hezzl_test/internal/http-server/openapi"
+	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/storage/clickhouse"
+	"hezzl_test/internal/warmup"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// routeStorage is what the routes read and write, *postgres.Storage in production
+type routeStorage interface {
+	graphql.Storage
+	goods.Searcher
+	goods.Suggester
+	goods.Batcher
+}
+
+// routeDeps are what the handlers work with, zero values are enough to build a router that is not served
+type routeDeps struct {
+	storage     routeStorage
+	goodsCache  cache.Cache
+	natsConn    *nats.Conn
+	redisClient *redis.Client
+	sinks       health.SinksHealth
+}
+
+func setupRouter(log *slog.Logger, cfg *config.Config, doc *openapi3.T, deps routeDeps) (*chi.Mux, error) {
+	const op = "cmd.app.setupRouter"
+
+	v1, err := v1Version(cfg.API)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	router := chi.NewRouter()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	// browser clients identify themselves to the rate limiter with the client header
+	allowedHeaders := []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"}
+	if cfg.RateLimit.ClientHeader != "" {
+		allowedHeaders = append(allowedHeaders, cfg.RateLimit.ClientHeader)
+	}
+
+	corsHandler := cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "DELETE", "PUT", "PATCH", "OPTIONS"},
+		AllowedHeaders: allowedHeaders,
+		ExposedHeaders: []string{
+			"Link", "Location", version.Header, "Deprecation", "Sunset",
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+		},
+		AllowCredentials: true,
+		MaxAge:           300,
+	})
+
+	router.Use(middleware.RequestID)
+	router.Use(middleware.Logger)
+	router.Use(logger.New(log))
+	router.Use(metrics.New(registry).Handler)
+	router.Use(middleware.Recoverer)
+	router.Use(corsHandler.Handler)
+
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		resp.Fail(w, r, resp.ErrRouteNotFound)
+	})
+	router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		resp.Fail(w, r, resp.ErrMethodNotAllowed)
+	})
+
+	// the validator runs inside the groups, after the version middleware, so rejected requests
+	// carry the version headers and are counted under their version and route
+	validate := func(next http.Handler) http.Handler { return next }
+	if cfg.OpenAPI.ValidateRequests {
+		validator, err := openapi.NewValidator(log, doc, cfg.OpenAPI.ValidateResponses)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		validate = validator.Handler
+	}
+
+	limiter := ratelimit.New(log, deps.redisClient, rateLimitOptions(cfg.RateLimit))
+
+	graphqlHandler, err := graphql.Handler(log, deps.storage, clickhouse.History, deps.goodsCache, deps.natsConn, limiter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// without Redis there is no rank index, lists are read from Postgres
+	var rankIndex *cache.RankIndex
+	if deps.redisClient != nil {
+		rankIndex = cache.NewRankIndex(deps.redisClient)
+	}
+
+	// v1 is served under /v1 and, for clients from before versioning, without a prefix
+	v1Routes := func(r chi.Router) {
+		r.Post("/good/create/{projectId}", goods.Create(log, deps.storage, deps.goodsCache, deps.natsConn))
+		r.Patch("/good/update/{id}/{projectId}", goods.Update(log, deps.storage, deps.goodsCache, deps.natsConn))
+		r.Delete("/good/remove/{id}/{projectId}", goods.Remove(log, deps.storage, deps.goodsCache, deps.natsConn))
+		r.Get("/goods/list", goods.List(log, deps.storage, deps.goodsCache, rankIndex))
+		r.Get("/goods/search", goods.Search(log, deps.storage))
+		r.Get("/goods/suggest", goods.Suggest(log, deps.storage, deps.goodsCache))
+		r.Patch("/good/reprioritize/{id}/{projectId}", goods.Reprioritize(log, deps.storage, deps.goodsCache, deps.natsConn))
+		r.Patch("/good/move/{id}/{projectId}", goods.Move(log, deps.storage, deps.goodsCache, deps.natsConn))
+	}
+
+	// the limiter and the metrics need the matched route, so the middlewares run in groups,
+	// which chi calls after routing, instead of on the router or the subrouters
+	router.Group(func(r chi.Router) {
+		r.Use(version.New(v1), validate, limiter.Handler)
+		v1Routes(r)
+	})
+	router.Route("/v1", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(version.New(v1), validate, limiter.Handler)
+			v1Routes(r)
+		})
+	})
+	router.Route("/v2", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(version.New(version.Version{Name: version.V2}), validate, limiter.Handler)
+
+			r.Get("/goods", goods.List(log, deps.storage, deps.goodsCache, rankIndex))
+			r.Get("/goods/search", goods.Search(log, deps.storage))
+			r.Get("/goods/suggest", goods.Suggest(log, deps.storage, deps.goodsCache))
+			r.Get("/projects/{projectId}/goods", goods.List(log, deps.storage, deps.goodsCache, rankIndex))
+			r.Post("/projects/{projectId}/goods", goods.Create(log, deps.storage, deps.goodsCache, deps.natsConn))
+			r.Get("/projects/{projectId}/goods/search", goods.Search(log, deps.storage))
+			r.Get("/projects/{projectId}/goods/suggest", goods.Suggest(log, deps.storage, deps.goodsCache))
+			r.Get("/projects/{projectId}/goods/{id}", goods.Get(log, deps.storage, deps.goodsCache))
+			r.Patch("/projects/{projectId}/goods/{id}", goods.Update(log, deps.storage, deps.goodsCache, deps.natsConn))
+			r.Delete("/projects/{projectId}/goods/{id}", goods.Remove(log, deps.storage, deps.goodsCache, deps.natsConn))
+			r.Put("/projects/{projectId}/goods/{id}/priority", goods.Reprioritize(log, deps.storage, deps.goodsCache, deps.natsConn))
+			r.Post("/projects/{projectId}/goods/{id}/move", goods.Move(log, deps.storage, deps.goodsCache, deps.natsConn))
+		})
+	})
+
+	spec, err := openapi.Spec(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	warmupJob := warmup.NewJob(warmup.New(deps.storage, deps.goodsCache))
+
+	router.Group(func(r chi.Router) {
+		r.Use(validate)
+
+		r.With(limiter.Handler).Post("/graphql", graphqlHandler.ServeHTTP)
+		r.With(limiter.Handler).Post("/batch", goods.Batch(log, deps.storage, deps.goodsCache, deps.natsConn, limiter))
+		r.Get("/health/sinks", health.Sinks(deps.sinks))
+
+		r.Get("/openapi.json", spec)
+		r.Get("/swagger", openapi.SwaggerUI("/openapi.json"))
+		r.Get("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP)
+	})
+
+	if cfg.Admin.Token == "" {
+		log.Warn("admin token is not set, the admin routes are disabled")
+	}
+
+	// admin requests are authenticated before anything else looks at them
+	router.Group(func(r chi.Router) {
+		r.Use(adminauth.New(cfg.Admin.Token), validate, limiter.Handler)
+
+		r.Post("/admin/cache/warmup", admin.StartWarmup(log, warmupJob, topProjects(cfg.Warmup), warmupOptions(cfg.Warmup), cfg.Warmup.TopProjects))
+		r.Get("/admin/cache/warmup", admin.WarmupStatus(warmupJob))
+	})
+
+	return router, nil
+}
+
+// v1Version is v1 with the deprecation dates of the config, v2 is its successor
+func v1Version(cfg config.API) (version.Version, error) {
+	const op = "cmd.app.v1Version"
+
+	v1 := version.Version{Name: version.V1}
+	if cfg.V1Deprecated == "" {
+		return v1, nil
+	}
+
+	deprecated, err := time.Parse(time.DateOnly, cfg.V1Deprecated)
+	if err != nil {
+		return v1, fmt.Errorf("%s: v1_deprecated: %w", op, err)
+	}
+	v1.Deprecated = deprecated
+	v1.Successor = "/swagger#/goods-v2"
+
+	if cfg.V1Sunset != "" {
+		if v1.Sunset, err = time.Parse(time.DateOnly, cfg.V1Sunset); err != nil {
+			return v1, fmt.Errorf("%s: v1_sunset: %w", op, err)
+		}
+	}
+
+	return v1, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/config"
+	"hezzl_test/internal/sink"
+	"log/slog"
+	"os"
+)
+
+// setupSinks builds the event fan-out from the sinks section of the config,
+// without any sinks configured events go to ClickHouse only
+func setupSinks(log *slog.Logger, sinks []config.Sink, redisClient *redis.Client) (*sink.Router, error) {
+	const op = "cmd.app.setupSinks"
+
+	if len(sinks) == 0 {
+		sinks = []config.Sink{{Name: "clickhouse", Type: "clickhouse"}}
+	}
+
+	batchers := make([]*sink.Batcher, 0, len(sinks))
+	for _, cfg := range sinks {
+		s, err := newSink(cfg, redisClient)
+		if err != nil {
+			return nil, fmt.Errorf("%s: sink %q: %w", op, cfg.Name, err)
+		}
+
+		name := cfg.Name
+		if name == "" {
+			name = cfg.Type
+		}
+
+		batchers = append(batchers, sink.NewBatcher(log, s, sink.Options{
+			Name:          name,
+			BatchSize:     cfg.BatchSize,
+			FlushInterval: cfg.FlushInterval,
+			QueueSize:     cfg.QueueSize,
+			RetryAttempts: cfg.Retry.Attempts,
+			RetryBackoff:  cfg.Retry.Backoff,
+			Filter: sink.Filter{
+				Projects: cfg.Filter.Projects,
+				Events:   cfg.Filter.Events,
+			},
+		}))
+
+		log.Info("event sink configured", slog.String("sink", name), slog.String("type", cfg.Type))
+	}
+
+	return sink.NewRouter(batchers...), nil
+}
+
+func newSink(cfg config.Sink, redisClient *redis.Client) (sink.Sink, error) {
+	switch cfg.Type {
+	case "clickhouse":
+		return sink.NewClickHouse(), nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("dir is required")
+		}
+		return sink.NewFile(cfg.Dir, cfg.MaxFileSize)
+	case "stdout":
+		return sink.NewStdout(os.Stdout), nil
+	case "rank_index":
+		return sink.NewRankIndex(cache.NewRankIndex(redisClient)), nil
+	case "webhook":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		return sink.NewWebhook(cfg.URL, cfg.Headers, cfg.Timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"hezzl_test/internal/config"
+	"hezzl_test/internal/storage/clickhouse"
+	"hezzl_test/internal/storage/postgres"
+	"hezzl_test/internal/warmup"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func runWarmup(ctx context.Context, cfg *config.Config, log *slog.Logger, args []string) error {
+	const op = "cmd.app.runWarmup"
+
+	fs := flag.NewFlagSet("warmup", flag.ContinueOnError)
+	projects := fs.String("projects", "", "comma separated project ids, the most active projects are warmed when empty")
+	top := fs.Int("top", cfg.Warmup.TopProjects, "number of most active projects to warm")
+	pages := fs.Int("pages", cfg.Warmup.Pages, "pages to preload per project")
+	pageSize := fs.Int("page-size", cfg.Warmup.PageSize, "goods per page")
+	concurrency := fs.Int("concurrency", cfg.Warmup.Concurrency, "projects warmed at the same time")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	opts := warmup.Options{
+		Projects:    cfg.Warmup.Projects,
+		Pages:       *pages,
+		PageSize:    *pageSize,
+		Concurrency: *concurrency,
+	}
+
+	if *projects != "" {
+		opts.Projects = nil
+		for _, value := range strings.Split(*projects, ",") {
+			projectId, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("%s: invalid project id %q", op, value)
+			}
+			opts.Projects = append(opts.Projects, projectId)
+		}
+	}
+
+	if len(opts.Projects) == 0 {
+		chDB, err := clickhouse.SetupClickHouseConnection(
+			cfg.ClickHouse.Host,
+			cfg.ClickHouse.Port,
+			cfg.ClickHouse.User,
+			cfg.ClickHouse.Password,
+			cfg.ClickHouse.DBName,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer chDB.Close()
+
+		opts.Projects, err = clickhouse.MostActiveProjects(ctx, chDB, *top, time.Now().Add(-cfg.Warmup.ActivityWindow))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	storage, err := postgres.New(
+		cfg.Postgres.Host,
+		cfg.Postgres.Port,
+		cfg.Postgres.User,
+		cfg.Postgres.Password,
+		cfg.Postgres.DBName,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Address,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	defer redisClient.Close()
+
+	// the command writes straight to Redis, an in-process tier would die with it
+	warmCache := setupCache(config.Cache{BreakerFailures: cfg.Cache.BreakerFailures, BreakerCooldown: cfg.Cache.BreakerCooldown}, redisClient)
+
+	log.Info("cache warm-up started", slog.Int("projects", len(opts.Projects)))
+
+	progress, err := warmup.New(storage, warmCache).Run(ctx, opts, func(progress warmup.Progress) {
+		log.Info("cache warm-up progress",
+			slog.Int("done", progress.Done),
+			slog.Int("projects", progress.Projects),
+			slog.Int("failed", progress.Failed),
+			slog.Int("pages", progress.Pages),
+			slog.Int("goods", progress.Goods),
+		)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("cache warm-up finished", slog.Int("pages", progress.Pages), slog.Int("goods", progress.Goods))
+
+	return nil
+}
+
+// warmupOptions are the options of warm-ups started through the admin endpoint
+func warmupOptions(cfg config.Warmup) warmup.Options {
+	return warmup.Options{
+		Projects:    cfg.Projects,
+		Pages:       cfg.Pages,
+		PageSize:    cfg.PageSize,
+		Concurrency: cfg.Concurrency,
+	}
+}
+
+// topProjects selects the most active projects of the configured activity window from ClickHouse
+func topProjects(cfg config.Warmup) func(ctx context.Context, top int) ([]int, error) {
+	return func(ctx context.Context, top int) ([]int, error) {
+		return clickhouse.TopProjects(ctx, top, time.Now().Add(-cfg.ActivityWindow))
+	}
+}
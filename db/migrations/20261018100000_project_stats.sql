@@ -0,0 +1,68 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS project_stats (
+                                             project_id INTEGER PRIMARY KEY NOT NULL,
+                                             total INTEGER NOT NULL DEFAULT 0,
+                                             active INTEGER NOT NULL DEFAULT 0,
+                                             removed INTEGER NOT NULL DEFAULT 0,
+                                             updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                             FOREIGN KEY (project_id) REFERENCES projects(id)
+);
+
+INSERT INTO project_stats (project_id, total, active, removed)
+SELECT project_id,
+       COUNT(*),
+       COUNT(*) FILTER (WHERE removed = false),
+       COUNT(*) FILTER (WHERE removed = true)
+FROM goods
+GROUP BY project_id
+ON CONFLICT (project_id) DO NOTHING;
+
+-- the counters are changed by triggers, so they are updated in the same transaction as
+-- every create, remove, restore or move of a good, whichever code path runs it
+CREATE OR REPLACE FUNCTION apply_project_stats(p_project_id INTEGER, p_removed BOOLEAN, p_delta INTEGER) RETURNS VOID AS $$
+BEGIN
+    INSERT INTO project_stats (project_id, total, active, removed)
+    VALUES (
+        p_project_id,
+        p_delta,
+        CASE WHEN p_removed THEN 0 ELSE p_delta END,
+        CASE WHEN p_removed THEN p_delta ELSE 0 END
+    )
+    ON CONFLICT (project_id) DO UPDATE SET
+        total = project_stats.total + EXCLUDED.total,
+        active = project_stats.active + EXCLUDED.active,
+        removed = project_stats.removed + EXCLUDED.removed,
+        updated_at = NOW();
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION update_project_stats() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM apply_project_stats(OLD.project_id, OLD.removed, -1);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM apply_project_stats(NEW.project_id, NEW.removed, 1);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER goods_project_stats_insert_delete AFTER INSERT OR DELETE ON goods
+    FOR EACH ROW EXECUTE FUNCTION update_project_stats();
+
+CREATE TRIGGER goods_project_stats_update AFTER UPDATE OF removed, project_id ON goods
+    FOR EACH ROW
+    WHEN (OLD.removed IS DISTINCT FROM NEW.removed OR OLD.project_id IS DISTINCT FROM NEW.project_id)
+    EXECUTE FUNCTION update_project_stats();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS goods_project_stats_update ON goods;
+DROP TRIGGER IF EXISTS goods_project_stats_insert_delete ON goods;
+DROP FUNCTION IF EXISTS update_project_stats;
+DROP FUNCTION IF EXISTS apply_project_stats;
+DROP TABLE IF EXISTS project_stats;
+-- +goose StatementEnd
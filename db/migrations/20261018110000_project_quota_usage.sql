@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS project_quota_usage (
+                                                   project_id INTEGER NOT NULL,
+                                                   minute TIMESTAMP NOT NULL,
+                                                   reprioritizes INTEGER NOT NULL DEFAULT 0,
+                                                   PRIMARY KEY (project_id, minute),
+                                                   FOREIGN KEY (project_id) REFERENCES projects(id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS project_quota_usage;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- names are mostly Russian: the russian configuration matches word forms, the simple one keeps
+-- words it does not know, such as brands and codes, searchable as they are written
+ALTER TABLE goods ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('russian', name), 'A') ||
+    setweight(to_tsvector('simple', name), 'A') ||
+    setweight(to_tsvector('russian', COALESCE(description, '')), 'B') ||
+    setweight(to_tsvector('simple', COALESCE(description, '')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS goods_search_vector ON goods USING GIN (search_vector);
+
+-- trigrams find names with typos that no lexeme matches
+CREATE INDEX IF NOT EXISTS goods_name_trgm ON goods USING GIN (name gin_trgm_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS goods_name_trgm;
+DROP INDEX IF EXISTS goods_search_vector;
+ALTER TABLE goods DROP COLUMN IF EXISTS search_vector;
+-- +goose StatementEnd
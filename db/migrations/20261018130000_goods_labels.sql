@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS tags (
+                                    id SERIAL PRIMARY KEY NOT NULL,
+                                    name VARCHAR NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS good_tags (
+                                         good_id INTEGER NOT NULL,
+                                         tag_id INTEGER NOT NULL,
+                                         PRIMARY KEY (good_id, tag_id),
+                                         FOREIGN KEY (good_id) REFERENCES goods(id) ON DELETE CASCADE,
+                                         FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+-- tag filters look goods up by tag, the primary key serves the tags of a good
+CREATE INDEX IF NOT EXISTS good_tags_tag ON good_tags (tag_id, good_id);
+
+ALTER TABLE goods ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+
+-- attribute filters are containment queries (attributes @> '{"color": "red"}'),
+-- jsonb_path_ops indexes them in a smaller index than the default operator class
+CREATE INDEX IF NOT EXISTS goods_attributes ON goods USING GIN (attributes jsonb_path_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS goods_attributes;
+ALTER TABLE goods DROP COLUMN IF EXISTS attributes;
+DROP TABLE IF EXISTS good_tags;
+DROP TABLE IF EXISTS tags;
+-- +goose StatementEnd
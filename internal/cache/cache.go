@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AllProjects is the scope of lists that are not narrowed to a single project
+	AllProjects = 0
+
+	PageTTL    = time.Minute
+	GoodTTL    = time.Minute
+	SuggestTTL = 30 * time.Second
+)
+
+// List cache keys are namespaced by a per-project generation counter. Every write to a project
+// increments the counter, after that no reader builds the old keys anymore, so all cached pages and
+// goods of the project are invalidated at once and the stale entries simply expire.
+
+const generationPrefix = "goods:gen:"
+
+// GenerationKey is the key of the generation counter of a list scope
+func GenerationKey(projectId int) string {
+	return fmt.Sprintf("%s%d", generationPrefix, projectId)
+}
+
+// isGeneration reports whether key is a generation counter, those are only read from the shared cache
+func isGeneration(key string) bool {
+	return strings.HasPrefix(key, generationPrefix)
+}
+
+// PageKey is the key of a cached page, the page holds the ordered ids of its goods
+func PageKey(projectId int, generation int64, filter string, limit, offset int) string {
+	return fmt.Sprintf("goods:page:%d:%d:%s:%d:%d", projectId, generation, filter, limit, offset)
+}
+
+// GoodKey is the key of a cached good within a list scope
+func GoodKey(projectId int, generation int64, goodId int) string {
+	return fmt.Sprintf("goods:item:%d:%d:%d", projectId, generation, goodId)
+}
+
+// StatsKey is the key of the cached counters of a list scope
+func StatsKey(projectId int, generation int64) string {
+	return fmt.Sprintf("goods:stats:%d:%d", projectId, generation)
+}
+
+// SuggestKey is the key of cached name suggestions for a prefix, the prefix is expected lower-cased
+func SuggestKey(projectId int, generation int64, limit int, prefix string) string {
+	return fmt.Sprintf("goods:suggest:%d:%d:%d:%s", projectId, generation, limit, prefix)
+}
+
+// Generation returns the current generation of a list scope, a scope that was never written to is at 0
+func Generation(ctx context.Context, c Cache, projectId int) (int64, error) {
+	const op = "cache.Generation"
+
+	value, err := c.Get(ctx, GenerationKey(projectId))
+	if errors.Is(err, ErrMiss) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	generation, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return generation, nil
+}
+
+// BumpGeneration invalidates every cached page and good of a project, together with the
+// lists over all projects which contain the project as well. It returns the new generation of the project.
+func BumpGeneration(ctx context.Context, c Cache, projectId int) (int64, error) {
+	const op = "cache.BumpGeneration"
+
+	generation, err := c.Incr(ctx, GenerationKey(projectId))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if projectId != AllProjects {
+		if _, err := c.Incr(ctx, GenerationKey(AllProjects)); err != nil {
+			return generation, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return generation, nil
+}
+
+// IsProjectKey reports whether a key belongs to the list cache of a project, lists over all
+// projects contain every project, so their keys match as well
+func IsProjectKey(key string, projectId int) bool {
+	for _, scope := range []int{projectId, AllProjects} {
+		if key == GenerationKey(scope) ||
+			strings.HasPrefix(key, fmt.Sprintf("goods:page:%d:", scope)) ||
+			strings.HasPrefix(key, fmt.Sprintf("goods:item:%d:", scope)) ||
+			strings.HasPrefix(key, fmt.Sprintf("goods:stats:%d:", scope)) ||
+			strings.HasPrefix(key, fmt.Sprintf("goods:suggest:%d:", scope)) {
+			return true
+		}
+	}
+
+	return false
+}
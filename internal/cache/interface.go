@@ -0,0 +1,26 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrMiss is returned when a key is not cached
+	ErrMiss = errors.New("cache miss")
+	// ErrUnavailable is returned while the cache backend is down, callers read from Postgres instead
+	ErrUnavailable = errors.New("cache unavailable")
+)
+
+// Cache is a byte oriented key value cache. MGet returns nil for every key that is not cached.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	MGet(ctx context.Context, keys ...string) ([][]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	MSet(ctx context.Context, items map[string][]byte, ttl time.Duration) error
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, keys ...string) error
+	DelIfEqual(ctx context.Context, key string, value []byte) error
+	Incr(ctx context.Context, key string) (int64, error)
+}
@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/singleflight"
+	"math"
+	mrand "math/rand"
+	"time"
+)
+
+const (
+	defaultLockTTL      = 5 * time.Second
+	defaultWaitTimeout  = 2 * time.Second
+	defaultPollInterval = 25 * time.Millisecond
+	// defaultLoadTimeout bounds a shared load, it does not end with the caller that started it
+	defaultLoadTimeout = defaultLockTTL
+
+	// earlyRefreshBeta tunes how eagerly entries are refreshed before they expire, 1 is the usual choice
+	earlyRefreshBeta = 1.0
+)
+
+// entry is the stored form of a value loaded through a Loader
+type entry struct {
+	Value  json.RawMessage `json:"value"`
+	Delta  int64           `json:"delta"`  // how long the value took to compute, in milliseconds
+	Expiry int64           `json:"expiry"` // logical expiry, unix milliseconds
+}
+
+// Loader protects hot keys from cache stampedes. Within the process concurrent misses of a key
+// share one load, across instances a short Redis lock lets a single caller rebuild the key while
+// the others wait for it or keep serving the previous value. Entries are refreshed early with a
+// probability that grows as they approach expiry, so popular keys rarely expire at all.
+type Loader struct {
+	cache Cache
+	group singleflight.Group
+
+	lockTTL      time.Duration
+	waitTimeout  time.Duration
+	pollInterval time.Duration
+	loadTimeout  time.Duration
+}
+
+func NewLoader(c Cache) *Loader {
+	return &Loader{
+		cache:        c,
+		lockTTL:      defaultLockTTL,
+		waitTimeout:  defaultWaitTimeout,
+		pollInterval: defaultPollInterval,
+		loadTimeout:  defaultLoadTimeout,
+	}
+}
+
+// Fetch returns the value of key, calling load when it is missing or due for refresh.
+// The value is kept in Redis for twice the ttl, the second half is only served while
+// another caller is rebuilding it.
+func (l *Loader) Fetch(ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	const op = "cache.Loader.Fetch"
+
+	// Redis errors are treated as a miss, the value is still loaded once per process
+	current, _ := l.get(ctx, key)
+
+	if current != nil && !current.needsRefresh(time.Now()) {
+		return current.Value, nil
+	}
+
+	value, err := l.share(ctx, key, func(ctx context.Context) ([]byte, error) {
+		return l.rebuild(ctx, key, ttl, current, load)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return value, nil
+}
+
+// Refresh loads and stores the value of key whether it is cached or not, e.g. to warm the cache up.
+// It shares the load with concurrent Fetch calls of the same key.
+func (l *Loader) Refresh(ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	const op = "cache.Loader.Refresh"
+
+	value, err := l.share(ctx, key, func(ctx context.Context) ([]byte, error) {
+		return l.rebuild(ctx, key, ttl, nil, load)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return value, nil
+}
+
+// share runs fn once for all concurrent callers of key. fn gets a context of its own, detached from
+// the caller that happened to start it, so that caller going away does not fail the load for the others.
+// Every caller still stops waiting when its own context is done.
+func (l *Loader) share(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	result := l.group.DoChan(key, func() (interface{}, error) {
+		shared, cancel := context.WithTimeout(context.WithoutCancel(ctx), l.loadTimeout)
+		defer cancel()
+
+		return fn(shared)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		return res.Val.([]byte), nil
+	}
+}
+
+func (l *Loader) rebuild(ctx context.Context, key string, ttl time.Duration, current *entry, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	// without Redis there is no lock to take, the caller loads the value itself
+	token, locked, err := l.lock(ctx, key)
+	if err == nil && !locked {
+		// somebody else is rebuilding, a slightly stale value is better than piling onto Postgres
+		if current != nil {
+			return current.Value, nil
+		}
+
+		if value := l.wait(ctx, key); value != nil {
+			return value, nil
+		}
+	}
+
+	if locked {
+		defer l.cache.DelIfEqual(context.Background(), lockKey(key), token)
+	}
+
+	started := time.Now()
+
+	value, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	data, err := json.Marshal(entry{
+		Value:  value,
+		Delta:  now.Sub(started).Milliseconds(),
+		Expiry: now.Add(ttl).UnixMilli(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the value is good even if it could not be cached
+	_ = l.cache.Set(ctx, key, data, 2*ttl)
+
+	return value, nil
+}
+
+// wait polls for a value stored by the lock holder, it gives up after the wait timeout
+func (l *Loader) wait(ctx context.Context, key string) []byte {
+	ticker := time.NewTicker(l.pollInterval)
+	defer ticker.Stop()
+
+	timeout := time.NewTimer(l.waitTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timeout.C:
+			return nil
+		case <-ticker.C:
+			current, err := l.get(ctx, key)
+			if err != nil {
+				return nil
+			}
+			if current != nil && current.Expiry > time.Now().UnixMilli() {
+				return current.Value
+			}
+		}
+	}
+}
+
+func (l *Loader) get(ctx context.Context, key string) (*entry, error) {
+	data, err := l.cache.Get(ctx, key)
+	if errors.Is(err, ErrMiss) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		// written in another format, rebuild it
+		return nil, nil
+	}
+
+	return &e, nil
+}
+
+func (l *Loader) lock(ctx context.Context, key string) ([]byte, bool, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, false, err
+	}
+	token := []byte(hex.EncodeToString(buf))
+
+	locked, err := l.cache.SetNX(ctx, lockKey(key), token, l.lockTTL)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return token, locked, nil
+}
+
+func lockKey(key string) string {
+	return key + ":lock"
+}
+
+// needsRefresh implements probabilistic early expiration (XFetch): the closer the expiry and the
+// more expensive the value, the more likely a caller refreshes it ahead of time
+func (e *entry) needsRefresh(now time.Time) bool {
+	gap := float64(e.Delta) * earlyRefreshBeta * -math.Log(1-mrand.Float64())
+
+	return float64(now.UnixMilli())+gap >= float64(e.Expiry)
+}
@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultLRUSize = 10000
+
+// LRU is a bounded in-process Cache, the least recently used entries are evicted first
+type LRU struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func NewLRU(size int) *LRU {
+	if size <= 0 {
+		size = defaultLRUSize
+	}
+
+	return &LRU{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+func (l *LRU) Get(_ context.Context, key string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	value, ok := l.get(key)
+	if !ok {
+		return nil, ErrMiss
+	}
+
+	return value, nil
+}
+
+func (l *LRU) MGet(_ context.Context, keys ...string) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if value, ok := l.get(key); ok {
+			values[i] = value
+		}
+	}
+
+	return values, nil
+}
+
+func (l *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.set(key, value, ttl)
+
+	return nil
+}
+
+func (l *LRU) MSet(_ context.Context, items map[string][]byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, value := range items {
+		l.set(key, value, ttl)
+	}
+
+	return nil
+}
+
+func (l *LRU) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.get(key); ok {
+		return false, nil
+	}
+	l.set(key, value, ttl)
+
+	return true, nil
+}
+
+func (l *LRU) Del(_ context.Context, keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		l.remove(key)
+	}
+
+	return nil
+}
+
+func (l *LRU) DelIfEqual(_ context.Context, key string, value []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if current, ok := l.get(key); ok && bytes.Equal(current, value) {
+		l.remove(key)
+	}
+
+	return nil
+}
+
+func (l *LRU) Incr(_ context.Context, key string) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var n int64
+	if value, ok := l.get(key); ok {
+		var err error
+		if n, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	n++
+	l.set(key, []byte(strconv.FormatInt(n, 10)), 0)
+
+	return n, nil
+}
+
+// DelFunc drops every entry whose key matches
+func (l *LRU) DelFunc(match func(key string) bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var removed int
+	for key, el := range l.entries {
+		if match(key) {
+			l.order.Remove(el)
+			delete(l.entries, key)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Flush drops every entry
+func (l *LRU) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = make(map[string]*list.Element, l.size)
+	l.order.Init()
+}
+
+// Len returns the number of entries, expired ones included until they are touched
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.order.Len()
+}
+
+func (l *LRU) get(key string) ([]byte, bool) {
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*lruEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		l.order.Remove(el)
+		delete(l.entries, key)
+		return nil, false
+	}
+
+	l.order.MoveToFront(el)
+
+	return e.value, true
+}
+
+func (l *LRU) set(key string, value []byte, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	if el, ok := l.entries[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value = value
+		e.expires = expires
+		l.order.MoveToFront(el)
+		return
+	}
+
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (l *LRU) remove(key string) {
+	if el, ok := l.entries[key]; ok {
+		l.order.Remove(el)
+		delete(l.entries, key)
+	}
+}
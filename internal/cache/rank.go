@@ -0,0 +1,418 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"hezzl_test/internal/entity"
+	"strconv"
+	"time"
+)
+
+const (
+	// rankShift makes room for the good id below the priority in a score, so goods with the same
+	// priority keep the id order Postgres uses. Scores stay exact while priorities are below 2^21.
+	rankShift = 1 << 32
+
+	// RankReadyTTL is how long a rebuilt index serves pages, rebuild it more often than that,
+	// an index that drifted from Postgres stops being used by itself
+	RankReadyTTL = 24 * time.Hour
+
+	// rebuildAttempts bounds how often a rebuild starts over because events were applied meanwhile
+	rebuildAttempts = 3
+
+	// appliedWindow is how long the id of an applied event is remembered, longer than a sink
+	// batch is retried, so a retried batch does not apply its events twice
+	appliedWindow = time.Hour
+)
+
+// ErrRebuildConflict is returned when events kept changing a project during every rebuild attempt
+var ErrRebuildConflict = errors.New("project changed during every rebuild attempt")
+
+// RankIndex keeps the ordering of every project in Redis: a sorted set of good ids scored by
+// priority and id and a hash with the good payloads, so an ordered page is served with ZRANGE and HMGET.
+// The index is updated from goods events and can be rebuilt from Postgres at any time.
+type RankIndex struct {
+	client *redis.Client
+}
+
+func NewRankIndex(client *redis.Client) *RankIndex {
+	return &RankIndex{client: client}
+}
+
+func rankKey(projectId int) string {
+	return fmt.Sprintf("goods:rank:%d", projectId)
+}
+
+func dataKey(projectId int) string {
+	return fmt.Sprintf("goods:data:%d", projectId)
+}
+
+func readyKey(projectId int) string {
+	return fmt.Sprintf("goods:rank:%d:ready", projectId)
+}
+
+// versionKey counts the events applied to a project, a rebuild that sees it change started from stale goods
+func versionKey(projectId int) string {
+	return fmt.Sprintf("goods:rank:%d:version", projectId)
+}
+
+// appliedKey holds the ids of the events recently applied to a project, scored by when they were applied
+func appliedKey(projectId int) string {
+	return fmt.Sprintf("goods:rank:%d:applied", projectId)
+}
+
+// indexGenerationKey holds the newest cache generation of a project whose write the index contains
+func indexGenerationKey(projectId int) string {
+	return fmt.Sprintf("goods:rank:%d:generation", projectId)
+}
+
+func score(priority, id int) float64 {
+	return float64(int64(priority)*rankShift + int64(id))
+}
+
+// reprioritizeScript mirrors Storage.Reprioritize: goods between the old and the new priority
+// are shifted by one before the good takes its new place. Shifting twice would move the neighbours
+// twice, so the event id is checked and marked applied in the same script. Scores are formatted with %d,
+// Lua would print them with too few digits.
+var reprioritizeScript = redis.NewScript(`
+local key = KEYS[1]
+local member = ARGV[1]
+local new = tonumber(ARGV[2])
+local shift = tonumber(ARGV[3])
+if ARGV[4] ~= '' then
+	if redis.call('ZSCORE', KEYS[2], ARGV[4]) then
+		return 0
+	end
+	redis.call('ZADD', KEYS[2], ARGV[5], ARGV[4])
+end
+local current = redis.call('ZSCORE', key, member)
+if current then
+	local old = math.floor(tonumber(current) / shift)
+	if new < old then
+		local goods = redis.call('ZRANGEBYSCORE', key, string.format('%d', new * shift), string.format('(%d', old * shift))
+		for _, m in ipairs(goods) do
+			redis.call('ZINCRBY', key, string.format('%d', shift), m)
+		end
+	elseif new > old then
+		local goods = redis.call('ZRANGEBYSCORE', key, string.format('%d', (old + 1) * shift), string.format('(%d', (new + 1) * shift))
+		for _, m in ipairs(goods) do
+			redis.call('ZINCRBY', key, string.format('%d', -shift), m)
+		end
+	end
+end
+redis.call('ZADD', key, string.format('%d', new * shift + tonumber(member)), member)
+return 1
+`)
+
+// appliedScript marks an event applied, forgets ids older than the window and raises
+// the generation of the index to the one the event was written in
+var appliedScript = redis.NewScript(`
+if ARGV[1] ~= '' then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+	redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', string.format('(%d', tonumber(ARGV[2]) - tonumber(ARGV[3])))
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+local generation = tonumber(ARGV[4])
+if generation > tonumber(redis.call('GET', KEYS[2]) or '0') then
+	redis.call('SET', KEYS[2], ARGV[4])
+end
+return 1
+`)
+
+// Ready reports whether the index of a project was built and contains every write up to
+// the cache generation, a write whose event the sink did not apply yet makes the index stale
+func (ri *RankIndex) Ready(ctx context.Context, projectId int, generation int64) (bool, error) {
+	const op = "cache.RankIndex.Ready"
+
+	values, err := ri.client.MGet(ctx, readyKey(projectId), indexGenerationKey(projectId)).Result()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if values[0] == nil {
+		return false, nil
+	}
+
+	var applied int64
+	if value, ok := values[1].(string); ok {
+		if applied, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return applied >= generation, nil
+}
+
+// Page returns goods of a project in priority order, the priority comes from the sorted set
+// since shifted neighbours never get their payload rewritten
+func (ri *RankIndex) Page(ctx context.Context, projectId, limit, offset int) ([]entity.GoodsForList, error) {
+	const op = "cache.RankIndex.Page"
+
+	ranked, err := ri.client.ZRangeWithScores(ctx, rankKey(projectId), int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	goods := make([]entity.GoodsForList, 0, len(ranked))
+	if len(ranked) == 0 {
+		return goods, nil
+	}
+
+	fields := make([]string, 0, len(ranked))
+	for _, z := range ranked {
+		fields = append(fields, z.Member.(string))
+	}
+
+	payloads, err := ri.client.HMGet(ctx, dataKey(projectId), fields...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i, payload := range payloads {
+		data, ok := payload.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: payload of good %s is missing", op, fields[i])
+		}
+
+		var good entity.GoodsForList
+		if err := json.Unmarshal([]byte(data), &good); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		good.Priority = int(int64(ranked[i].Score) / rankShift)
+
+		goods = append(goods, good)
+	}
+
+	return goods, nil
+}
+
+// Apply updates the index with a goods event, events already applied are skipped.
+// An event that failed to apply is missing from the index, so the project stops being
+// served from it until the next rebuild.
+func (ri *RankIndex) Apply(ctx context.Context, event entity.GoodEvent) error {
+	const op = "cache.RankIndex.Apply"
+
+	if err := ri.apply(ctx, event); err != nil {
+		projects := []int{event.ProjectId}
+		if event.Type == "moved" && event.PreviousProjectId != 0 {
+			projects = append(projects, event.PreviousProjectId)
+		}
+		for _, projectId := range projects {
+			if delErr := ri.client.Del(ctx, readyKey(projectId)).Err(); delErr != nil {
+				err = errors.Join(err, delErr)
+			}
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (ri *RankIndex) apply(ctx context.Context, event entity.GoodEvent) error {
+	if event.EventId != "" {
+		err := ri.client.ZScore(ctx, appliedKey(event.ProjectId), event.EventId).Err()
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, redis.Nil) {
+			return err
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	member := strconv.Itoa(event.Id)
+
+	payload, err := json.Marshal(entity.GoodsForList{
+		Id:          event.Id,
+		ProjectId:   event.ProjectId,
+		Name:        event.Name,
+		Description: event.Description,
+		Priority:    event.Priority,
+		Removed:     event.Removed,
+		CreatedAt:   event.EventTime,
+		GoodLabels:  event.GoodLabels,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the version moves before the index does, a rebuild that read Postgres earlier sees it and starts over
+	if err := ri.client.Incr(ctx, versionKey(event.ProjectId)).Err(); err != nil {
+		return err
+	}
+	if event.Type == "moved" && event.PreviousProjectId != 0 {
+		if err := ri.client.Incr(ctx, versionKey(event.PreviousProjectId)).Err(); err != nil {
+			return err
+		}
+	}
+
+	switch event.Type {
+	case "reprioritized":
+		keys := []string{rankKey(event.ProjectId), appliedKey(event.ProjectId)}
+		err = reprioritizeScript.Run(ctx, ri.client, keys, member, event.Priority, rankShift, event.EventId, now).Err()
+		if err == nil {
+			err = ri.updatePayload(ctx, event.ProjectId, member, payload)
+		}
+	case "moved":
+		pipe := ri.client.TxPipeline()
+		if event.PreviousProjectId != 0 {
+			pipe.ZRem(ctx, rankKey(event.PreviousProjectId), member)
+			pipe.HDel(ctx, dataKey(event.PreviousProjectId), member)
+		}
+		pipe.ZAdd(ctx, rankKey(event.ProjectId), redis.Z{Score: score(event.Priority, event.Id), Member: member})
+		pipe.HSet(ctx, dataKey(event.ProjectId), member, payload)
+		_, err = pipe.Exec(ctx)
+	case entity.PatchedEvent:
+		err = ri.patchPayload(ctx, event.ProjectId, member, event.Changes)
+	case "updated", "removed":
+		// the created_at of a good is not part of these events, keep the one already indexed
+		err = ri.updatePayload(ctx, event.ProjectId, member, payload)
+	default:
+		pipe := ri.client.TxPipeline()
+		pipe.ZAdd(ctx, rankKey(event.ProjectId), redis.Z{Score: score(event.Priority, event.Id), Member: member})
+		pipe.HSet(ctx, dataKey(event.ProjectId), member, payload)
+		_, err = pipe.Exec(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if event.Type == "moved" && event.PreviousProjectId != 0 {
+		if err := ri.markApplied(ctx, event.PreviousProjectId, "", now, event.PreviousGeneration); err != nil {
+			return err
+		}
+	}
+
+	return ri.markApplied(ctx, event.ProjectId, event.EventId, now, event.Generation)
+}
+
+func (ri *RankIndex) markApplied(ctx context.Context, projectId int, eventId string, now, generation int64) error {
+	keys := []string{appliedKey(projectId), indexGenerationKey(projectId)}
+
+	return appliedScript.Run(ctx, ri.client, keys, eventId, now, appliedWindow.Milliseconds(), generation).Err()
+}
+
+func (ri *RankIndex) updatePayload(ctx context.Context, projectId int, member string, payload []byte) error {
+	current, err := ri.client.HGet(ctx, dataKey(projectId), member).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	if err == nil {
+		var indexed, updated entity.GoodsForList
+		if json.Unmarshal([]byte(current), &indexed) == nil && json.Unmarshal(payload, &updated) == nil {
+			updated.CreatedAt = indexed.CreatedAt
+			payload, _ = json.Marshal(updated)
+		}
+	}
+
+	return ri.client.HSet(ctx, dataKey(projectId), member, payload).Err()
+}
+
+// patchPayload sets the changed fields on the indexed good, a good that is not indexed is left to a rebuild
+func (ri *RankIndex) patchPayload(ctx context.Context, projectId int, member string, changes map[string]any) error {
+	current, err := ri.client.HGet(ctx, dataKey(projectId), member).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var good entity.GoodsForList
+	if err := json.Unmarshal([]byte(current), &good); err != nil {
+		return err
+	}
+	if err := entity.ApplyChanges(&good, changes); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(good)
+	if err != nil {
+		return err
+	}
+
+	return ri.client.HSet(ctx, dataKey(projectId), member, payload).Err()
+}
+
+// Rebuild replaces the index of a project with the goods load returns and marks it ready.
+// The new index is written under temporary keys and renamed over the live ones,
+// so readers never see a half built index. Events applied while the goods were loaded
+// would be lost in the swap, so then the rebuild starts over with freshly loaded goods.
+func (ri *RankIndex) Rebuild(ctx context.Context, projectId int, load func() ([]entity.GoodsForList, error)) (int, error) {
+	const op = "cache.RankIndex.Rebuild"
+
+	for attempt := 0; attempt < rebuildAttempts; attempt++ {
+		n, err := ri.rebuild(ctx, projectId, load)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return n, nil
+	}
+
+	return 0, fmt.Errorf("%s: %w", op, ErrRebuildConflict)
+}
+
+func (ri *RankIndex) rebuild(ctx context.Context, projectId int, load func() ([]entity.GoodsForList, error)) (int, error) {
+	var n int
+
+	err := ri.client.Watch(ctx, func(tx *redis.Tx) error {
+		// the goods are loaded after the generation is read, so they contain every write up to it
+		generation, err := ri.client.Get(ctx, GenerationKey(projectId)).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		goods, err := load()
+		if err != nil {
+			return err
+		}
+		n = len(goods)
+
+		tmpRank := rankKey(projectId) + ":rebuild"
+		tmpData := dataKey(projectId) + ":rebuild"
+
+		pipe := ri.client.Pipeline()
+		pipe.Del(ctx, tmpRank, tmpData)
+
+		for _, good := range goods {
+			payload, err := json.Marshal(good)
+			if err != nil {
+				return err
+			}
+
+			member := strconv.Itoa(good.Id)
+			pipe.ZAdd(ctx, tmpRank, redis.Z{Score: score(good.Priority, good.Id), Member: member})
+			pipe.HSet(ctx, tmpData, member, payload)
+		}
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+
+		// the swap only happens if no event was applied since the watch started
+		_, err = tx.TxPipelined(ctx, func(swap redis.Pipeliner) error {
+			if len(goods) == 0 {
+				swap.Del(ctx, rankKey(projectId), dataKey(projectId))
+			} else {
+				swap.Rename(ctx, tmpRank, rankKey(projectId))
+				swap.Rename(ctx, tmpData, dataKey(projectId))
+			}
+			swap.Set(ctx, indexGenerationKey(projectId), generation, 0)
+			swap.Set(ctx, readyKey(projectId), 1, RankReadyTTL)
+
+			return nil
+		})
+
+		return err
+	}, versionKey(projectId))
+
+	return n, err
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// Redis is a Cache backed by Redis. Calls go through a circuit breaker, so during an outage
+// they fail fast with ErrUnavailable instead of waiting for timeouts.
+type Redis struct {
+	client  *redis.Client
+	breaker *Breaker
+}
+
+func NewRedis(client *redis.Client, breaker *Breaker) *Redis {
+	if breaker == nil {
+		breaker = NewBreaker(0, 0)
+	}
+
+	return &Redis{
+		client:  client,
+		breaker: breaker,
+	}
+}
+
+// Available reports whether the breaker lets calls through to Redis
+func (r *Redis) Available() bool {
+	return r.breaker.Ready()
+}
+
+func (r *Redis) do(fn func() error) error {
+	if !r.breaker.Allow() {
+		return ErrUnavailable
+	}
+
+	err := fn()
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// the caller gave up, Redis did not fail
+		r.breaker.Cancel()
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		r.breaker.Failure()
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	r.breaker.Success()
+
+	if err != nil {
+		return ErrMiss
+	}
+
+	return nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+
+	err := r.do(func() (err error) {
+		value, err = r.client.Get(ctx, key).Bytes()
+		return err
+	})
+
+	return value, err
+}
+
+func (r *Redis) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	err := r.do(func() error {
+		result, err := r.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+
+		for i, v := range result {
+			if s, ok := v.(string); ok {
+				values[i] = []byte(s)
+			}
+		}
+
+		return nil
+	})
+
+	return values, err
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.do(func() error {
+		return r.client.Set(ctx, key, value, ttl).Err()
+	})
+}
+
+func (r *Redis) MSet(ctx context.Context, items map[string][]byte, ttl time.Duration) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	return r.do(func() error {
+		pipe := r.client.Pipeline()
+		for key, value := range items {
+			pipe.Set(ctx, key, value, ttl)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+}
+
+func (r *Redis) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	var ok bool
+
+	err := r.do(func() (err error) {
+		ok, err = r.client.SetNX(ctx, key, value, ttl).Result()
+		return err
+	})
+
+	return ok, err
+}
+
+func (r *Redis) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return r.do(func() error {
+		return r.client.Del(ctx, keys...).Err()
+	})
+}
+
+var delIfEqualScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func (r *Redis) DelIfEqual(ctx context.Context, key string, value []byte) error {
+	return r.do(func() error {
+		return delIfEqualScript.Run(ctx, r.client, []string{key}, value).Err()
+	})
+}
+
+func (r *Redis) Incr(ctx context.Context, key string) (int64, error) {
+	var value int64
+
+	err := r.do(func() (err error) {
+		value, err = r.client.Incr(ctx, key).Result()
+		return err
+	})
+
+	return value, err
+}
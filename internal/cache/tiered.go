@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultLocalTTL = 5 * time.Second
+
+// Remote is the shared tier of a Tiered cache
+type Remote interface {
+	Cache
+	Available() bool
+}
+
+// Tiered puts a short lived in-process LRU in front of the shared cache. Locks and counters
+// only live in the shared tier. While the shared tier is unavailable every read reports
+// ErrUnavailable, so callers go to Postgres instead of serving entries nobody can invalidate,
+// and the local tier is flushed once the shared tier is back. Generation counters are never kept locally,
+// a stale one would keep serving the pages of a project that was written to on another instance.
+type Tiered struct {
+	local    *LRU
+	remote   Remote
+	localTTL time.Duration
+
+	mu         sync.Mutex
+	remoteDown bool
+}
+
+func NewTiered(local *LRU, remote Remote, localTTL time.Duration) *Tiered {
+	if localTTL <= 0 {
+		localTTL = defaultLocalTTL
+	}
+
+	return &Tiered{
+		local:    local,
+		remote:   remote,
+		localTTL: localTTL,
+	}
+}
+
+// Local returns the in-process tier
+func (t *Tiered) Local() *LRU {
+	return t.local
+}
+
+func (t *Tiered) available() bool {
+	up := t.remote.Available()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !up {
+		t.remoteDown = true
+		return false
+	}
+
+	if t.remoteDown {
+		t.remoteDown = false
+		t.local.Flush()
+	}
+
+	return true
+}
+
+func (t *Tiered) ttl(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > t.localTTL {
+		return t.localTTL
+	}
+
+	return ttl
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) ([]byte, error) {
+	if !t.available() {
+		return nil, ErrUnavailable
+	}
+
+	if isGeneration(key) {
+		return t.remote.Get(ctx, key)
+	}
+
+	if value, err := t.local.Get(ctx, key); err == nil {
+		return value, nil
+	}
+
+	value, err := t.remote.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = t.local.Set(ctx, key, value, t.localTTL)
+
+	return value, nil
+}
+
+func (t *Tiered) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	if !t.available() {
+		return nil, ErrUnavailable
+	}
+
+	values, _ := t.local.MGet(ctx, keys...)
+	for i, key := range keys {
+		if isGeneration(key) {
+			values[i] = nil
+		}
+	}
+
+	var missing []string
+	var positions []int
+	for i, value := range values {
+		if value == nil {
+			missing = append(missing, keys[i])
+			positions = append(positions, i)
+		}
+	}
+
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	remote, err := t.remote.MGet(ctx, missing...)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string][]byte, len(missing))
+	for i, value := range remote {
+		if value == nil {
+			continue
+		}
+		values[positions[i]] = value
+		if !isGeneration(missing[i]) {
+			found[missing[i]] = value
+		}
+	}
+
+	_ = t.local.MSet(ctx, found, t.localTTL)
+
+	return values, nil
+}
+
+func (t *Tiered) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if !isGeneration(key) {
+		_ = t.local.Set(ctx, key, value, t.ttl(ttl))
+	}
+
+	return t.remote.Set(ctx, key, value, ttl)
+}
+
+func (t *Tiered) MSet(ctx context.Context, items map[string][]byte, ttl time.Duration) error {
+	local := make(map[string][]byte, len(items))
+	for key, value := range items {
+		if !isGeneration(key) {
+			local[key] = value
+		}
+	}
+	_ = t.local.MSet(ctx, local, t.ttl(ttl))
+
+	return t.remote.MSet(ctx, items, ttl)
+}
+
+func (t *Tiered) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return t.remote.SetNX(ctx, key, value, ttl)
+}
+
+func (t *Tiered) Del(ctx context.Context, keys ...string) error {
+	_ = t.local.Del(ctx, keys...)
+
+	return t.remote.Del(ctx, keys...)
+}
+
+func (t *Tiered) DelIfEqual(ctx context.Context, key string, value []byte) error {
+	return t.remote.DelIfEqual(ctx, key, value)
+}
+
+func (t *Tiered) Incr(ctx context.Context, key string) (int64, error) {
+	_ = t.local.Del(ctx, key)
+
+	return t.remote.Incr(ctx, key)
+}
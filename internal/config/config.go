@@ -4,16 +4,30 @@ import (
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/joho/godotenv"
 	"log"
+	"log/slog"
 	"os"
 	"time"
 )
 
+// redacted replaces secrets when the config is logged
+const redacted = "[REDACTED]"
+
 type Config struct {
 	Env        string `yaml:"env" env-default:"local"`
 	HTTPServer `yaml:"http_server"`
+	GRPCServer `yaml:"grpc_server"`
 	Postgres   `yaml:"postgres"`
 	ClickHouse `yaml:"clickHouse"`
 	Redis      `yaml:"redis"`
+	Cache      `yaml:"cache"`
+	Spool      `yaml:"spool"`
+	Sinks      []Sink `yaml:"sinks"`
+	RateLimit  `yaml:"rate_limit"`
+	Quotas     `yaml:"quotas"`
+	Warmup     `yaml:"warmup"`
+	OpenAPI    `yaml:"openapi"`
+	API        `yaml:"api"`
+	Admin      `yaml:"admin"`
 }
 
 type HTTPServer struct {
@@ -21,6 +35,13 @@ type HTTPServer struct {
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
 }
+
+// GRPCServer is the gRPC API, it runs next to the HTTP server on its own address
+type GRPCServer struct {
+	Address    string `yaml:"address" env-default:"localhost:9090"`
+	Reflection bool   `yaml:"reflection" env-default:"true"`
+}
+
 type Postgres struct {
 	Host     string `yaml:"host" env-default:"localhost"`
 	Port     string `yaml:"port" env-default:"5432"`
@@ -44,6 +65,152 @@ type Redis struct {
 	DB       int    `yaml:"db" env-default:"0"`
 }
 
+// Cache configures the in-process tier in front of Redis and the Redis circuit breaker
+type Cache struct {
+	LocalSize       int           `yaml:"local_size" env-default:"10000"` // 0 disables the in-process tier
+	LocalTTL        time.Duration `yaml:"local_ttl" env-default:"5s"`
+	BreakerFailures int           `yaml:"breaker_failures" env-default:"5"`
+	BreakerCooldown time.Duration `yaml:"breaker_cooldown" env-default:"10s"`
+}
+
+// Spool is the local fallback for events that could not be written to ClickHouse
+type Spool struct {
+	Dir               string        `yaml:"dir" env-default:"./spool"`
+	MaxFileSize       int64         `yaml:"max_file_size" env-default:"67108864"`
+	BackfillInterval  time.Duration `yaml:"backfill_interval" env-default:"30s"`
+	ReconnectInterval time.Duration `yaml:"reconnect_interval" env-default:"10s"`
+}
+
+// Sink is a destination of goods events, every sink batches, retries and filters independently
+type Sink struct {
+	Name          string        `yaml:"name"`
+	Type          string        `yaml:"type"` // clickhouse, file, stdout, webhook or rank_index
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	QueueSize     int           `yaml:"queue_size"`
+	Retry         SinkRetry     `yaml:"retry"`
+	Filter        SinkFilter    `yaml:"filter"`
+
+	// file
+	Dir         string `yaml:"dir"`
+	MaxFileSize int64  `yaml:"max_file_size"`
+
+	// webhook
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+type SinkRetry struct {
+	Attempts int           `yaml:"attempts"`
+	Backoff  time.Duration `yaml:"backoff"`
+}
+
+type SinkFilter struct {
+	Projects []int    `yaml:"projects"`
+	Events   []string `yaml:"events"`
+}
+
+// RateLimit configures the sliding window request limits of the API, zero requests disable a limit
+type RateLimit struct {
+	ClientHeader string           `yaml:"client_header" env-default:"X-API-Key"`
+	ClientKeys   []string         `yaml:"client_keys" env:"RATE_LIMIT_CLIENT_KEYS" env-separator:","`
+	Client       RateLimitWindow  `yaml:"client"`
+	Project      RateLimitWindow  `yaml:"project"`
+	Routes       []RateLimitRoute `yaml:"routes"`
+}
+
+type RateLimitWindow struct {
+	Requests int           `yaml:"requests"`
+	Window   time.Duration `yaml:"window" env-default:"1m"`
+}
+
+// RateLimitRoute limits a route per client, Pattern is the route as registered in the router.
+// Routes with the same Name share one window.
+type RateLimitRoute struct {
+	Name            string `yaml:"name"`
+	Method          string `yaml:"method"`
+	Pattern         string `yaml:"pattern"`
+	RateLimitWindow `yaml:",inline"`
+}
+
+// Quotas are enforced by the storage, Projects overrides Default for single projects
+type Quotas struct {
+	Default  Quota         `yaml:"default"`
+	Projects map[int]Quota `yaml:"projects"`
+}
+
+// Quota limits a project, zero values mean unlimited
+type Quota struct {
+	MaxGoods                  int `yaml:"max_goods"`
+	MaxReprioritizesPerMinute int `yaml:"max_reprioritizes_per_minute"`
+}
+
+// Warmup configures which list pages are preloaded into the cache by the warm-up command and endpoint
+type Warmup struct {
+	Projects       []int         `yaml:"projects"` // warmed instead of the most active projects when set
+	TopProjects    int           `yaml:"top_projects" env-default:"20"`
+	ActivityWindow time.Duration `yaml:"activity_window" env-default:"168h"`
+	Pages          int           `yaml:"pages" env-default:"5"`
+	PageSize       int           `yaml:"page_size" env-default:"10"`
+	Concurrency    int           `yaml:"concurrency" env-default:"4"`
+}
+
+// OpenAPI configures the validation against the OpenAPI spec, response mismatches are only logged
+type OpenAPI struct {
+	ValidateRequests  bool `yaml:"validate_requests" env-default:"true"`
+	ValidateResponses bool `yaml:"validate_responses" env-default:"false"`
+}
+
+// API configures the versions of the HTTP API, dates are YYYY-MM-DD.
+// v1 responses announce the deprecation and the sunset, an empty V1Deprecated leaves v1 current.
+type API struct {
+	V1Deprecated string `yaml:"v1_deprecated" env-default:"2026-10-01"`
+	V1Sunset     string `yaml:"v1_sunset" env-default:"2027-04-01"`
+}
+
+// Admin protects the /admin routes, they are disabled while Token is empty
+type Admin struct {
+	Token string `yaml:"token" env:"ADMIN_TOKEN"`
+}
+
+// LogValue logs the config with passwords, tokens, client keys and webhook header values redacted
+func (c Config) LogValue() slog.Value {
+	// the alias has no LogValue method, so logging it does not recurse
+	type config Config
+
+	redact := func(secret string) string {
+		if secret == "" {
+			return ""
+		}
+		return redacted
+	}
+
+	c.Postgres.Password = redact(c.Postgres.Password)
+	c.ClickHouse.Password = redact(c.ClickHouse.Password)
+	c.Redis.Password = redact(c.Redis.Password)
+	c.Admin.Token = redact(c.Admin.Token)
+
+	if len(c.RateLimit.ClientKeys) > 0 {
+		c.RateLimit.ClientKeys = []string{redacted}
+	}
+
+	sinks := make([]Sink, len(c.Sinks))
+	for i, sink := range c.Sinks {
+		if len(sink.Headers) > 0 {
+			headers := make(map[string]string, len(sink.Headers))
+			for name := range sink.Headers {
+				headers[name] = redacted
+			}
+			sink.Headers = headers
+		}
+		sinks[i] = sink
+	}
+	c.Sinks = sinks
+
+	return slog.AnyValue(config(c))
+}
+
 func MustLoad() *Config {
 	if err := godotenv.Load(); err != nil {
 		log.Printf("Warning: .env file not found or error loading it: %v", err)
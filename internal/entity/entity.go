@@ -1,11 +1,17 @@
 package entity
 
 import (
+	"encoding/json"
 	"time"
 )
 
+// PatchedEvent is the type of the events of patches, they carry only the fields the patch changed
+const PatchedEvent = "patched"
+
 // GoodEvent request for ClickHouse
 type GoodEvent struct {
+	EventId     string    `json:"eventId"` // unique per produced event, used for deduplication
+	Type        string    `json:"type"`    // created, updated, patched, removed, reprioritized or moved
 	Id          int       `json:"id"`
 	ProjectId   int       `json:"projectId"`
 	Name        string    `json:"name"`
@@ -13,11 +19,79 @@ type GoodEvent struct {
 	Priority    int       `json:"priority"`
 	Removed     bool      `json:"removed"`
 	EventTime   time.Time `json:"createdAt"`
+
+	PreviousProjectId int `json:"previousProjectId,omitempty"` // set by moved events
+
+	// Generation is the cache generation of the project the write produced, the rank index
+	// serves the project again once it applied the event. Moved events carry the one
+	// of the previous project as well.
+	Generation         int64 `json:"generation,omitempty"`
+	PreviousGeneration int64 `json:"previousGeneration,omitempty"`
+
+	GoodLabels
+
+	// Changes holds only the fields a patch changed, with their new values, a cleared description is null.
+	// Patched events carry nothing of the good but its id and project besides them.
+	Changes map[string]any `json:"changes,omitempty"`
+}
+
+// MarshalJSON leaves the state of the good out of patched events
+func (e GoodEvent) MarshalJSON() ([]byte, error) {
+	type event GoodEvent
+	if e.Type != PatchedEvent {
+		return json.Marshal(event(e))
+	}
+
+	return json.Marshal(struct {
+		EventId    string         `json:"eventId"`
+		Type       string         `json:"type"`
+		Id         int            `json:"id"`
+		ProjectId  int            `json:"projectId"`
+		EventTime  time.Time      `json:"createdAt"`
+		Generation int64          `json:"generation,omitempty"`
+		Changes    map[string]any `json:"changes"`
+	}{e.EventId, e.Type, e.Id, e.ProjectId, e.EventTime, e.Generation, e.Changes})
+}
+
+// ApplyChanges sets the fields a patched event changed on good, the others are left as they are
+func ApplyChanges(good *GoodsForList, changes map[string]any) error {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	// unmarshalling into a map adds to it, the changed attributes replace the old ones
+	if _, ok := changes["attributes"]; ok {
+		good.Attributes = nil
+	}
+	if err := json.Unmarshal(data, good); err != nil {
+		return err
+	}
+
+	// null leaves a string alone when unmarshalled, a cleared description has to be cleared here
+	if description, ok := changes["description"]; ok && description == nil {
+		good.Description = ""
+	}
+
+	return nil
+}
+
+// GoodLabels are the tags and the free-form attributes of a good. Tags are lower-cased, sorted and unique.
+// In writes a nil field is left as it is, an empty one clears it.
+type GoodLabels struct {
+	Tags       []string       `json:"tags"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// GoodsFilter narrows a list to the goods that have every tag and every attribute value
+type GoodsFilter struct {
+	Tags       []string
+	Attributes map[string]string
 }
 
 // GoodCreateRequest request for create good
 type GoodCreateRequest struct {
-	Name string `json:"name"`
+	Name string `json:"name" validate:"trim,required,maxlen=255"`
+	GoodLabels
 }
 
 // GoodCreateResponse response for good create request
@@ -29,12 +103,16 @@ type GoodCreateResponse struct {
 	Priority    int       `json:"priority"`
 	Removed     bool      `json:"removed"`
 	CreatedAt   time.Time `json:"createdAt"`
+	GoodLabels
 }
 
 // GoodUpdateRequest request for good update
 type GoodUpdateRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description,omitempty"` // optional field
+	Name        string `json:"name" validate:"trim,required,maxlen=255"`
+	Description string `json:"description,omitempty" validate:"trim,maxlen=1000"` // optional field
+
+	// optional, omitted labels are kept
+	GoodLabels
 }
 
 // GoodUpdateResponse response for good update request
@@ -46,6 +124,20 @@ type GoodUpdateResponse struct {
 	Priority    int       `json:"priority"`
 	Removed     bool      `json:"removed"`
 	CreatedAt   time.Time `json:"createdAt"`
+	GoodLabels
+}
+
+// GoodDocument is a good as the JSON document patches are applied to, only name, description, tags
+// and attributes may change. A nil Description is null.
+type GoodDocument struct {
+	Id          int       `json:"id"`
+	ProjectId   int       `json:"projectId"`
+	Name        *string   `json:"name" validate:"trim,required,maxlen=255"`
+	Description *string   `json:"description" validate:"trim,maxlen=1000"`
+	Priority    int       `json:"priority"`
+	Removed     bool      `json:"removed"`
+	CreatedAt   time.Time `json:"createdAt"`
+	GoodLabels
 }
 
 // GoodRemoveResponse response for good delete request
@@ -64,11 +156,27 @@ type GoodsListResponse struct {
 // MetaForList response for list request
 type MetaForList struct {
 	Total   int `json:"total"`
+	Active  int `json:"active"`
 	Removed int `json:"removed"`
 	Limit   int `json:"limit"`
 	Offset  int `json:"offset"`
 }
 
+// Project a project goods belong to
+type Project struct {
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ProjectStats goods counters of a project
+type ProjectStats struct {
+	ProjectId int `json:"projectId"`
+	Total     int `json:"total"`
+	Active    int `json:"active"`
+	Removed   int `json:"removed"`
+}
+
 // GoodsForList response for list request
 type GoodsForList struct {
 	Id          int       `json:"id"`
@@ -78,11 +186,39 @@ type GoodsForList struct {
 	Priority    int       `json:"priority"`
 	Removed     bool      `json:"removed"`
 	CreatedAt   time.Time `json:"createdAt"`
+	GoodLabels
 }
 
 // ReprioritizeRequest request for Reprioritize
 type ReprioritizeRequest struct {
-	NewPriority int `json:"newPriority"`
+	NewPriority int `json:"newPriority" validate:"min=1"` // must not be past the last good of the project either
+}
+
+// MoveRequest request for moving a good to another project
+type MoveRequest struct {
+	NewProjectId int `json:"newProjectId" validate:"min=1"`
+}
+
+// BatchRequest request for running several writes in one transaction,
+// Atomic is true if omitted: one failing operation rolls back every other
+type BatchRequest struct {
+	Atomic     *bool            `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is a write of a batch: create, update, remove, reprioritize or move.
+// The good is set by id and projectId, or by Ref, the index of an earlier operation of the batch.
+type BatchOperation struct {
+	Op           string  `json:"op"`
+	Ref          *int    `json:"ref" validate:"min=0"`
+	Id           int     `json:"id" validate:"min=0"`
+	ProjectId    int     `json:"projectId" validate:"min=0"`
+	Name         *string `json:"name" validate:"trim,maxlen=255"`         // create, update
+	Description  *string `json:"description" validate:"trim,maxlen=1000"` // update, optional
+	NewPriority  *int    `json:"newPriority" validate:"min=1"`            // reprioritize
+	NewProjectId *int    `json:"newProjectId" validate:"min=1"`           // move
+
+	GoodLabels // create, update, optional
 }
 
 // ReprioritizeResponse response for reprioritize request
@@ -90,3 +226,37 @@ type ReprioritizeResponse struct {
 	Id       int `json:"id"`
 	Priority int `json:"priority"`
 }
+
+// GoodsSearchResponse response for search request
+type GoodsSearchResponse struct {
+	Meta  MetaForSearch      `json:"meta"`
+	Goods []GoodSearchResult `json:"goods"`
+}
+
+// MetaForSearch response for search request
+type MetaForSearch struct {
+	Query  string `json:"query"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// GoodSearchResult a good found by search, best matches have the highest rank
+type GoodSearchResult struct {
+	GoodsForList
+	Rank      float64         `json:"rank"`
+	Highlight SearchHighlight `json:"highlight"`
+}
+
+// SearchHighlight name and description with the matched words in <mark> tags, the rest of the text is HTML-escaped
+type SearchHighlight struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// GoodSuggestion a good suggested for a typed prefix of its name
+type GoodSuggestion struct {
+	Id        int    `json:"id"`
+	ProjectId int    `json:"projectId"`
+	Name      string `json:"name"`
+	Priority  int    `json:"priority"`
+}
@@ -0,0 +1,102 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"hezzl_test/internal/entity"
+	"hezzl_test/internal/storage/clickhouse"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+const (
+	FormatNDJSON  = "ndjson"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+
+	defaultChunkSize = 10000
+)
+
+// Options describes a single export run
+type Options struct {
+	Filter    clickhouse.EventFilter
+	Format    string
+	Path      string
+	ChunkSize int
+}
+
+// Run streams the events matching opts.Filter into a file at opts.Path.
+// Events are handed to the writer in chunks of opts.ChunkSize, and the file
+// is written under a temporary name and renamed only when the export succeeds.
+func Run(ctx context.Context, log *slog.Logger, chDB driver.Conn, opts Options) (int, error) {
+	const op = "export.Run"
+
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultChunkSize
+	}
+
+	tmpPath := opts.Path + ".part"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+
+	writer, err := NewWriter(opts.Format, file)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var (
+		total int
+		chunk = make([]entity.GoodEvent, 0, opts.ChunkSize)
+	)
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := writer.WriteChunk(chunk); err != nil {
+			return err
+		}
+		total += len(chunk)
+		chunk = chunk[:0]
+
+		log.Info("export progress", slog.Int("events", total))
+
+		return nil
+	}
+
+	err = clickhouse.StreamEvents(ctx, chDB, opts.Filter, func(event entity.GoodEvent) error {
+		chunk = append(chunk, event)
+		if len(chunk) < opts.ChunkSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return total, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := flush(); err != nil {
+		return total, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return total, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return total, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := os.Rename(tmpPath, filepath.Clean(opts.Path)); err != nil {
+		return total, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return total, nil
+}
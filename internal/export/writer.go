@@ -0,0 +1,222 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/parquet-go/parquet-go"
+	"hezzl_test/internal/entity"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Writer encodes chunks of events into an output stream
+type Writer interface {
+	WriteChunk(events []entity.GoodEvent) error
+	Close() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatNDJSON:
+		return newNDJSONWriter(w), nil
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatParquet:
+		return newParquetWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buf := bufio.NewWriter(w)
+
+	return &ndjsonWriter{
+		buf: buf,
+		enc: json.NewEncoder(buf),
+	}
+}
+
+func (n *ndjsonWriter) WriteChunk(events []entity.GoodEvent) error {
+	for _, event := range events {
+		if err := n.enc.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	return n.buf.Flush()
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.buf.Flush()
+}
+
+var csvHeader = []string{"event_id", "type", "id", "project_id", "name", "description", "priority", "removed", "event_time", "changes"}
+
+// hasField reports whether an event carries a field of the good, patched events carry only the changed ones
+func hasField(event entity.GoodEvent, field string) bool {
+	if event.Type != entity.PatchedEvent {
+		return true
+	}
+	_, ok := event.Changes[field]
+
+	return ok
+}
+
+// changesJSON encodes the changes of a patched event, other events have none
+func changesJSON(event entity.GoodEvent) (string, error) {
+	if event.Type != entity.PatchedEvent {
+		return "", nil
+	}
+
+	data, err := json.Marshal(event.Changes)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return nil, err
+	}
+
+	return &csvWriter{w: cw}, nil
+}
+
+// WriteChunk leaves the fields a patched event did not change empty, its changes column lists the changed ones
+func (c *csvWriter) WriteChunk(events []entity.GoodEvent) error {
+	for _, event := range events {
+		changes, err := changesJSON(event)
+		if err != nil {
+			return err
+		}
+
+		record := []string{
+			event.EventId,
+			event.Type,
+			strconv.Itoa(event.Id),
+			strconv.Itoa(event.ProjectId),
+			"",
+			"",
+			"",
+			"",
+			event.EventTime.UTC().Format(time.RFC3339),
+			changes,
+		}
+		if hasField(event, "name") {
+			record[4] = event.Name
+		}
+		if hasField(event, "description") {
+			record[5] = event.Description
+		}
+		if hasField(event, "priority") {
+			record[6] = strconv.Itoa(event.Priority)
+		}
+		if hasField(event, "removed") {
+			record[7] = strconv.FormatBool(event.Removed)
+		}
+
+		if err := c.w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+// parquetEvent has the fields of the good optional, they are null in patched events unless changed
+type parquetEvent struct {
+	EventId     string    `parquet:"event_id"`
+	Type        string    `parquet:"type"`
+	Id          int32     `parquet:"id"`
+	ProjectId   int32     `parquet:"project_id"`
+	Name        *string   `parquet:"name,optional"`
+	Description *string   `parquet:"description,optional"`
+	Priority    *int32    `parquet:"priority,optional"`
+	Removed     *bool     `parquet:"removed,optional"`
+	EventTime   time.Time `parquet:"event_time,timestamp(millisecond)"`
+	Changes     *string   `parquet:"changes,optional"`
+}
+
+// parquetWriter writes every chunk as its own row group, so only one chunk is buffered at a time
+type parquetWriter struct {
+	w    *parquet.GenericWriter[parquetEvent]
+	rows []parquetEvent
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{
+		w: parquet.NewGenericWriter[parquetEvent](w),
+	}
+}
+
+func (p *parquetWriter) WriteChunk(events []entity.GoodEvent) error {
+	p.rows = p.rows[:0]
+	for _, event := range events {
+		row := parquetEvent{
+			EventId:   event.EventId,
+			Type:      event.Type,
+			Id:        int32(event.Id),
+			ProjectId: int32(event.ProjectId),
+			EventTime: event.EventTime,
+		}
+		if hasField(event, "name") {
+			name := event.Name
+			row.Name = &name
+		}
+		if hasField(event, "description") {
+			description := event.Description
+			row.Description = &description
+		}
+		if hasField(event, "priority") {
+			priority := int32(event.Priority)
+			row.Priority = &priority
+		}
+		if hasField(event, "removed") {
+			removed := event.Removed
+			row.Removed = &removed
+		}
+		if event.Type == entity.PatchedEvent {
+			changes, err := changesJSON(event)
+			if err != nil {
+				return err
+			}
+			row.Changes = &changes
+		}
+
+		p.rows = append(p.rows, row)
+	}
+
+	if _, err := p.w.Write(p.rows); err != nil {
+		return err
+	}
+
+	return p.w.Flush()
+}
+
+func (p *parquetWriter) Close() error {
+	return p.w.Close()
+}
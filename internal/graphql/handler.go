@@ -0,0 +1,49 @@
+package graphql
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	gql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/nats-io/nats.go"
+	"hezzl_test/internal/cache"
+	handlers "hezzl_test/internal/http-server/handlers/goods"
+	resp "hezzl_test/internal/lib/api/response"
+	"log/slog"
+	"net/http"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// maxDepth bounds nesting such as good { project { goods { items { project ... } } } }
+const maxDepth = 8
+
+// Handler serves GraphQL queries and mutations over POST, every request gets its own batch loaders.
+// Every mutation is counted by limiter in the window of its REST route, like an operation of a batch.
+func Handler(log *slog.Logger, storage Storage, history HistorySource, goodsCache cache.Cache, natsConn *nats.Conn, limiter handlers.OperationLimiter) (http.Handler, error) {
+	const op = "graphql.Handler"
+
+	resolver := &Resolver{
+		log:        log.With(slog.String("component", "graphql")),
+		storage:    storage,
+		goodsCache: goodsCache,
+		natsConn:   natsConn,
+		limiter:    limiter,
+	}
+
+	parsed, err := gql.ParseSchema(schema, resolver, gql.MaxDepth(maxDepth))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	handler := &relay.Handler{Schema: parsed}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := withLoaders(r.Context(), newLoaders(storage, history))
+		ctx = context.WithValue(ctx, languageKey{}, resp.Language(r))
+		ctx = context.WithValue(ctx, requestKey{}, r)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}), nil
+}
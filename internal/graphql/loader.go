@@ -0,0 +1,137 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+)
+
+// Loader batches lookups by key within a request. Keys are primed as soon as they are known,
+// e.g. every good of a page, and the first Load fetches all primed keys in one call, so
+// resolving a field of every item of a list costs one query instead of one per item.
+// Loads of keys that are already being fetched wait for that fetch.
+type Loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu       sync.Mutex
+	primed   map[K]struct{}
+	inflight map[K]chan struct{}
+	loaded   map[K]V
+	failed   map[K]error // a nil error marks a key the fetch did not return
+}
+
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{
+		fetch:    fetch,
+		primed:   make(map[K]struct{}),
+		inflight: make(map[K]chan struct{}),
+		loaded:   make(map[K]V),
+		failed:   make(map[K]error),
+	}
+}
+
+// Prime registers keys to be fetched with the next batch
+func (l *Loader[K, V]) Prime(keys ...K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if !l.known(key) {
+			l.primed[key] = struct{}{}
+		}
+	}
+}
+
+// Set stores a value that was loaded another way
+func (l *Loader[K, V]) Set(key K, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.primed, key)
+	l.loaded[key] = value
+}
+
+// Load returns the value of key, fetching it together with every primed key.
+// The bool is false if the fetch did not return the key.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, bool, error) {
+	l.mu.Lock()
+
+	for {
+		if value, ok := l.loaded[key]; ok {
+			l.mu.Unlock()
+			return value, true, nil
+		}
+		if err, ok := l.failed[key]; ok {
+			l.mu.Unlock()
+			var zero V
+			return zero, false, err
+		}
+
+		wait, ok := l.inflight[key]
+		if !ok {
+			break
+		}
+
+		l.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			var zero V
+			return zero, false, ctx.Err()
+		}
+		l.mu.Lock()
+	}
+
+	done := make(chan struct{})
+
+	keys := []K{key}
+	l.inflight[key] = done
+	for k := range l.primed {
+		if k != key {
+			keys = append(keys, k)
+			l.inflight[k] = done
+		}
+	}
+	l.primed = make(map[K]struct{})
+
+	// the lock is not held while fetching, fetches prime other loaders
+	l.mu.Unlock()
+	values, err := l.fetch(ctx, keys)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, k := range keys {
+		delete(l.inflight, k)
+
+		if err != nil {
+			l.failed[k] = err
+			continue
+		}
+		if value, ok := values[k]; ok {
+			l.loaded[k] = value
+		} else {
+			l.failed[k] = nil
+		}
+	}
+	close(done)
+
+	if err != nil {
+		var zero V
+		return zero, false, err
+	}
+
+	value, ok := l.loaded[key]
+
+	return value, ok, nil
+}
+
+func (l *Loader[K, V]) known(key K) bool {
+	if _, ok := l.loaded[key]; ok {
+		return true
+	}
+	if _, ok := l.failed[key]; ok {
+		return true
+	}
+	_, ok := l.inflight[key]
+
+	return ok
+}
@@ -0,0 +1,197 @@
+package graphql
+
+import (
+	"context"
+	"hezzl_test/internal/entity"
+	"sync"
+	"sync/atomic"
+)
+
+type loadersKey struct{}
+
+// pageArgs identify a page of goods that is loaded for many projects at once
+type pageArgs struct {
+	removed string
+	limit   int
+	offset  int
+}
+
+// Loaders are the batch loaders of one request. Whatever one loader fetches is primed in the loaders
+// of the fields that may be asked of it next: fetched projects prime their stats and goods pages,
+// pages prime their goods, goods prime their projects and histories. Every level of a response
+// is therefore loaded in one query, however many items the level above it has.
+type Loaders struct {
+	storage Storage
+	history HistorySource
+
+	projects *Loader[int, entity.Project]
+	stats    *Loader[int, entity.ProjectStats]
+	goods    *Loader[int, entity.GoodsForList]
+
+	items atomic.Int64 // asked for by the lists of the query so far
+
+	mu         sync.Mutex
+	projectIds []int
+	goodIds    []int
+	pages      map[pageArgs]*Loader[int, []int]
+	histories  map[int]*Loader[int, []entity.GoodEvent]
+}
+
+func newLoaders(storage Storage, history HistorySource) *Loaders {
+	l := &Loaders{
+		storage:   storage,
+		history:   history,
+		pages:     make(map[pageArgs]*Loader[int, []int]),
+		histories: make(map[int]*Loader[int, []entity.GoodEvent]),
+	}
+
+	l.projects = NewLoader(func(_ context.Context, ids []int) (map[int]entity.Project, error) {
+		projects, err := storage.GetProjectsByIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+
+		byId := make(map[int]entity.Project, len(projects))
+		for _, project := range projects {
+			byId[project.Id] = project
+		}
+		l.seeProjects(ids...)
+
+		return byId, nil
+	})
+
+	l.stats = NewLoader(func(_ context.Context, ids []int) (map[int]entity.ProjectStats, error) {
+		return storage.ProjectStatsByIDs(ids)
+	})
+
+	l.goods = NewLoader(func(_ context.Context, ids []int) (map[int]entity.GoodsForList, error) {
+		goods, err := storage.GetGoodsByIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+
+		byId := make(map[int]entity.GoodsForList, len(goods))
+		for _, good := range goods {
+			byId[good.Id] = good
+		}
+		l.seeGoods(goods...)
+
+		return byId, nil
+	})
+
+	return l
+}
+
+func withLoaders(ctx context.Context, loaders *Loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, loaders)
+}
+
+func loadersFrom(ctx context.Context) *Loaders {
+	return ctx.Value(loadersKey{}).(*Loaders)
+}
+
+// charge counts n more items asked for by the query, false once the query asks for more than maxItems
+func (l *Loaders) charge(n int) bool {
+	return l.items.Add(int64(n)) <= maxItems
+}
+
+// seeProjects primes the loaders of project fields with projects that are part of the response
+func (l *Loaders) seeProjects(ids ...int) {
+	l.mu.Lock()
+	l.projectIds = append(l.projectIds, ids...)
+	pages := make([]*Loader[int, []int], 0, len(l.pages))
+	for _, page := range l.pages {
+		pages = append(pages, page)
+	}
+	l.mu.Unlock()
+
+	l.stats.Prime(ids...)
+	for _, page := range pages {
+		page.Prime(ids...)
+	}
+}
+
+// seeGoods primes the loaders of good fields with goods that are part of the response
+func (l *Loaders) seeGoods(goods ...entity.GoodsForList) {
+	ids := make([]int, len(goods))
+	projectIds := make([]int, len(goods))
+	for i, good := range goods {
+		ids[i] = good.Id
+		projectIds[i] = good.ProjectId
+	}
+
+	l.mu.Lock()
+	l.goodIds = append(l.goodIds, ids...)
+	histories := make([]*Loader[int, []entity.GoodEvent], 0, len(l.histories))
+	for _, history := range l.histories {
+		histories = append(histories, history)
+	}
+	l.mu.Unlock()
+
+	l.projects.Prime(projectIds...)
+	for _, history := range histories {
+		history.Prime(ids...)
+	}
+}
+
+// page returns the loader of a page of goods ids per project
+func (l *Loaders) page(removed *bool, limit, offset int) *Loader[int, []int] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	args := pageArgs{removed: "all", limit: limit, offset: offset}
+	if removed != nil && *removed {
+		args.removed = "removed"
+	} else if removed != nil {
+		args.removed = "active"
+	}
+
+	page, ok := l.pages[args]
+	if !ok {
+		page = NewLoader(func(_ context.Context, projectIds []int) (map[int][]int, error) {
+			pages, err := l.storage.ListGoodIDsByProjects(projectIds, removed, limit, offset)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, ids := range pages {
+				l.goods.Prime(ids...)
+			}
+
+			return pages, nil
+		})
+		page.Prime(l.projectIds...)
+		l.pages[args] = page
+	}
+
+	return page
+}
+
+// historyOf returns the loader of the last limit events per good
+func (l *Loaders) historyOf(limit int) *Loader[int, []entity.GoodEvent] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	history, ok := l.histories[limit]
+	if !ok {
+		history = NewLoader(func(ctx context.Context, ids []int) (map[int][]entity.GoodEvent, error) {
+			events, err := l.history(ctx, ids, limit)
+			if err != nil {
+				return nil, err
+			}
+
+			// goods without events have an empty history rather than a missing one
+			for _, id := range ids {
+				if _, ok := events[id]; !ok {
+					events[id] = []entity.GoodEvent{}
+				}
+			}
+
+			return events, nil
+		})
+		history.Prime(l.goodIds...)
+		l.histories[limit] = history
+	}
+
+	return history
+}
@@ -0,0 +1,427 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"github.com/nats-io/nats.go"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/entity"
+	handlers "hezzl_test/internal/http-server/handlers/goods"
+	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/lib/logger/sl"
+	"hezzl_test/internal/lib/validate"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Storage is what the resolvers need from the database, the goods part is shared with the HTTP handlers
+type Storage interface {
+	handlers.Goods
+	ListProjects(limit, offset int) ([]entity.Project, error)
+	GetProjectsByIDs(ids []int) ([]entity.Project, error)
+	ProjectStatsByIDs(ids []int) (map[int]entity.ProjectStats, error)
+	ListGoodIDsByProjects(projectIds []int, removed *bool, limit, offset int) (map[int][]int, error)
+}
+
+// HistorySource returns the last limit events of each of the goods, newest first
+type HistorySource func(ctx context.Context, ids []int, limit int) (map[int][]entity.GoodEvent, error)
+
+// Resolver is the root of the schema, queries read like the REST list and mutations write like the REST handlers:
+// the cache of the project is invalidated and an event is published after every change
+type Resolver struct {
+	log        *slog.Logger
+	storage    Storage
+	goodsCache cache.Cache
+	natsConn   *nats.Conn
+	limiter    handlers.OperationLimiter
+}
+
+type languageKey struct{}
+
+// requestKey holds the HTTP request, the limiter identifies the client by it
+type requestKey struct{}
+
+// apiError is an error of the API catalog as a GraphQL error, its code and details are sent in the extensions
+type apiError struct {
+	err      *resp.Error
+	language string
+}
+
+func (e apiError) Error() string {
+	return e.err.Message(e.language)
+}
+
+func (e apiError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.err.Code}
+	if details := e.err.DetailsIn(e.language); len(details) > 0 {
+		extensions["details"] = details
+	}
+
+	return extensions
+}
+
+// fail returns err in the language of the request, errors outside the catalog are internal errors
+func fail(ctx context.Context, err error) error {
+	apiErr := resp.ErrInternal
+	errors.As(err, &apiErr)
+
+	language, _ := ctx.Value(languageKey{}).(string)
+
+	return apiError{err: apiErr, language: language}
+}
+
+// storageError maps storage errors like the REST handlers do, unexpected errors are logged and hidden
+func (r *Resolver) storageError(ctx context.Context, op string, err error) error {
+	apiErr := handlers.StorageError(err)
+	if errors.Is(apiErr, resp.ErrInternal) {
+		r.log.Error("storage error", slog.String("op", op), sl.Err(err))
+	}
+
+	return fail(ctx, apiErr)
+}
+
+// take counts a mutation in the rate limit window of the REST route named route, so a request
+// with many aliased mutations is limited like as many REST requests
+func (r *Resolver) take(ctx context.Context, op, route string) error {
+	req, ok := ctx.Value(requestKey{}).(*http.Request)
+	if !ok {
+		return nil
+	}
+
+	allowed, reset, err := r.limiter.TakeOperations(req, map[string]int{route: 1})
+	if err != nil {
+		// Redis being down must not take the API down with it
+		r.log.Warn("rate limit check failed, mutation allowed", slog.String("op", op), sl.Err(err))
+		return nil
+	}
+	if !allowed {
+		return fail(ctx, resp.ErrRateLimited.With("retryAfter", int(math.Ceil(reset.Seconds()))))
+	}
+
+	return nil
+}
+
+const (
+	// maxLimit bounds pages like the REST search does, maxHistoryLimit bounds the events of a good
+	maxLimit        = 100
+	maxHistoryLimit = 20
+	// maxItems bounds the items a whole query asks for, a list charges its limit once per parent,
+	// so projects(limit: 100) { goods(limit: 100) } asks for 10100
+	maxItems = 10000
+)
+
+// pagination checks limit and offset arguments and charges the limit to the query, their defaults are set in the schema
+func pagination(ctx context.Context, limit, offset int32, max int) (int, int, error) {
+	if limit <= 0 {
+		return 0, 0, fail(ctx, resp.ErrValidationFailed.WithFields(resp.FieldError{Field: "limit", Rule: "min", Param: "1"}))
+	}
+	if int(limit) > max {
+		return 0, 0, fail(ctx, resp.ErrValidationFailed.WithFields(resp.FieldError{Field: "limit", Rule: "max", Param: strconv.Itoa(max)}))
+	}
+	if offset < 0 {
+		return 0, 0, fail(ctx, resp.ErrValidationFailed.WithFields(resp.FieldError{Field: "offset", Rule: "min", Param: "0"}))
+	}
+	if !loadersFrom(ctx).charge(int(limit)) {
+		return 0, 0, fail(ctx, resp.ErrValidationFailed.WithFields(resp.FieldError{Field: "query", Rule: "complexity", Param: strconv.Itoa(maxItems)}))
+	}
+
+	return int(limit), int(offset), nil
+}
+
+func (r *Resolver) Project(ctx context.Context, args struct{ Id int32 }) (*projectResolver, error) {
+	const op = "graphql.Project"
+
+	project, ok, err := loadersFrom(ctx).projects.Load(ctx, int(args.Id))
+	if err != nil {
+		return nil, r.storageError(ctx, op, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	return &projectResolver{root: r, project: project}, nil
+}
+
+func (r *Resolver) Projects(ctx context.Context, args struct{ Limit, Offset int32 }) ([]*projectResolver, error) {
+	const op = "graphql.Projects"
+
+	limit, offset, err := pagination(ctx, args.Limit, args.Offset, maxLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := r.storage.ListProjects(limit, offset)
+	if err != nil {
+		return nil, r.storageError(ctx, op, err)
+	}
+
+	loaders := loadersFrom(ctx)
+
+	ids := make([]int, len(projects))
+	resolvers := make([]*projectResolver, len(projects))
+	for i, project := range projects {
+		loaders.projects.Set(project.Id, project)
+		ids[i] = project.Id
+		resolvers[i] = &projectResolver{root: r, project: project}
+	}
+	loaders.seeProjects(ids...)
+
+	return resolvers, nil
+}
+
+func (r *Resolver) Good(ctx context.Context, args struct{ Id int32 }) (*goodResolver, error) {
+	const op = "graphql.Good"
+
+	good, ok, err := loadersFrom(ctx).goods.Load(ctx, int(args.Id))
+	if err != nil {
+		return nil, r.storageError(ctx, op, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	return &goodResolver{root: r, good: good}, nil
+}
+
+func (r *Resolver) Goods(ctx context.Context, args struct {
+	ProjectId     *int32
+	Removed       *bool
+	Limit, Offset int32
+}) (*pageResolver, error) {
+	const op = "graphql.Goods"
+
+	limit, offset, err := pagination(ctx, args.Limit, args.Offset, maxLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.ProjectId != nil {
+		projectId := int(*args.ProjectId)
+		loadersFrom(ctx).seeProjects(projectId)
+
+		return newProjectPage(ctx, r, projectId, args.Removed, limit, offset)
+	}
+
+	// goods of every project are listed in one page, not one page per project
+	ids, err := r.storage.ListGoodIDs(0, args.Removed, limit, offset)
+	if err != nil {
+		return nil, r.storageError(ctx, op, err)
+	}
+	loadersFrom(ctx).goods.Prime(ids...)
+
+	return &pageResolver{root: r, ids: ids, limit: limit, offset: offset}, nil
+}
+
+func (r *Resolver) CreateGood(ctx context.Context, args struct {
+	ProjectId  int32
+	Name       string
+	Tags       *[]string
+	Attributes *JSON
+}) (*goodResolver, error) {
+	const op = "graphql.CreateGood"
+
+	if err := r.take(ctx, op, "create"); err != nil {
+		return nil, err
+	}
+
+	req := entity.GoodCreateRequest{Name: args.Name, GoodLabels: labels(args.Tags, args.Attributes)}
+	if err := validate.Struct(&req); err != nil {
+		return nil, fail(ctx, err)
+	}
+	if failed := handlers.CheckLabels(&req.GoodLabels, ""); len(failed) > 0 {
+		return nil, fail(ctx, resp.ErrValidationFailed.WithFields(failed...))
+	}
+
+	response, err := r.storage.CreateGood(int(args.ProjectId), req.Name, req.GoodLabels)
+	if err != nil {
+		return nil, r.storageError(ctx, op, err)
+	}
+
+	handlers.Written(r.log.With(slog.String("op", op)), r.goodsCache, r.natsConn, &entity.GoodEvent{
+		Type:        "created",
+		Id:          response.Id,
+		ProjectId:   response.ProjectId,
+		Name:        response.Name,
+		Description: response.Description,
+		Priority:    response.Priority,
+		Removed:     false,
+		EventTime:   response.CreatedAt,
+		GoodLabels:  response.GoodLabels,
+	})
+
+	return r.written(ctx, entity.GoodsForList(response)), nil
+}
+
+func (r *Resolver) UpdateGood(ctx context.Context, args struct {
+	Id, ProjectId int32
+	Name          string
+	Description   *string
+	Tags          *[]string
+	Attributes    *JSON
+}) (*goodResolver, error) {
+	const op = "graphql.UpdateGood"
+
+	if err := r.take(ctx, op, "update"); err != nil {
+		return nil, err
+	}
+
+	req := entity.GoodUpdateRequest{Name: args.Name, GoodLabels: labels(args.Tags, args.Attributes)}
+	if args.Description != nil {
+		req.Description = *args.Description
+	}
+	if err := validate.Struct(&req); err != nil {
+		return nil, fail(ctx, err)
+	}
+	if failed := handlers.CheckLabels(&req.GoodLabels, ""); len(failed) > 0 {
+		return nil, fail(ctx, resp.ErrValidationFailed.WithFields(failed...))
+	}
+
+	response, err := r.storage.UpdateGood(int(args.Id), int(args.ProjectId), req.Name, req.Description, req.GoodLabels)
+	if err != nil {
+		return nil, r.storageError(ctx, op, err)
+	}
+
+	handlers.Written(r.log.With(slog.String("op", op)), r.goodsCache, r.natsConn, &entity.GoodEvent{
+		Type:        "updated",
+		Id:          response.Id,
+		ProjectId:   response.ProjectId,
+		Name:        response.Name,
+		Description: response.Description,
+		Priority:    response.Priority,
+		Removed:     response.Removed,
+		EventTime:   time.Now(),
+		GoodLabels:  response.GoodLabels,
+	})
+
+	return r.written(ctx, entity.GoodsForList(response)), nil
+}
+
+// labels reads the label arguments of a mutation, omitted ones stay nil and are left as they are
+func labels(tags *[]string, attributes *JSON) entity.GoodLabels {
+	var labels entity.GoodLabels
+	if tags != nil {
+		labels.Tags = append([]string{}, *tags...)
+	}
+	if attributes != nil {
+		labels.Attributes = map[string]any(*attributes)
+		if labels.Attributes == nil {
+			labels.Attributes = map[string]any{}
+		}
+	}
+
+	return labels
+}
+
+func (r *Resolver) RemoveGood(ctx context.Context, args struct{ Id, ProjectId int32 }) (*removedResolver, error) {
+	const op = "graphql.RemoveGood"
+
+	if err := r.take(ctx, op, "remove"); err != nil {
+		return nil, err
+	}
+
+	response, name, description, priority, labels, err := r.storage.DeleteGood(int(args.Id), int(args.ProjectId))
+	if err != nil {
+		return nil, r.storageError(ctx, op, err)
+	}
+
+	handlers.Written(r.log.With(slog.String("op", op)), r.goodsCache, r.natsConn, &entity.GoodEvent{
+		Type:        "removed",
+		Id:          response.Id,
+		ProjectId:   response.ProjectId,
+		Name:        name,
+		Description: description,
+		Priority:    priority,
+		Removed:     true,
+		EventTime:   time.Now(),
+		GoodLabels:  labels,
+	})
+
+	return &removedResolver{response: response}, nil
+}
+
+func (r *Resolver) ReprioritizeGood(ctx context.Context, args struct{ Id, ProjectId, NewPriority int32 }) (*reprioritizedResolver, error) {
+	const op = "graphql.ReprioritizeGood"
+
+	if err := r.take(ctx, op, "reprioritize"); err != nil {
+		return nil, err
+	}
+
+	id, projectId, priority := int(args.Id), int(args.ProjectId), int(args.NewPriority)
+
+	if err := validate.Struct(&entity.ReprioritizeRequest{NewPriority: priority}); err != nil {
+		return nil, fail(ctx, err)
+	}
+
+	name, description, labels, err := r.storage.Reprioritize(id, projectId, priority)
+	if err != nil {
+		return nil, r.storageError(ctx, op, err)
+	}
+
+	handlers.Written(r.log.With(slog.String("op", op)), r.goodsCache, r.natsConn, &entity.GoodEvent{
+		Type:        "reprioritized",
+		Id:          id,
+		ProjectId:   projectId,
+		Name:        name,
+		Description: description,
+		Priority:    priority,
+		Removed:     false,
+		EventTime:   time.Now(),
+		GoodLabels:  labels,
+	})
+
+	return &reprioritizedResolver{response: entity.ReprioritizeResponse{Id: id, Priority: priority}}, nil
+}
+
+func (r *Resolver) MoveGood(ctx context.Context, args struct{ Id, ProjectId, NewProjectId int32 }) (*goodResolver, error) {
+	const op = "graphql.MoveGood"
+
+	if err := r.take(ctx, op, "move"); err != nil {
+		return nil, err
+	}
+
+	if err := validate.Struct(&entity.MoveRequest{NewProjectId: int(args.NewProjectId)}); err != nil {
+		return nil, fail(ctx, err)
+	}
+	if args.NewProjectId == args.ProjectId {
+		return nil, fail(ctx, resp.ErrValidationFailed.WithFields(resp.FieldError{Field: "newProjectId", Rule: "changed"}))
+	}
+
+	good, err := r.storage.MoveGood(int(args.Id), int(args.ProjectId), int(args.NewProjectId))
+	if err != nil {
+		return nil, r.storageError(ctx, op, err)
+	}
+
+	// the good left one project and joined another, both are cached separately
+	previousGeneration, err := handlers.InvalidateRedisCache(r.goodsCache, r.natsConn, int(args.ProjectId))
+	if err != nil {
+		r.log.Error("Redis cache invalidation error", slog.String("op", op), sl.Err(err))
+	}
+
+	handlers.Written(r.log.With(slog.String("op", op)), r.goodsCache, r.natsConn, &entity.GoodEvent{
+		Type:               "moved",
+		Id:                 good.Id,
+		ProjectId:          good.ProjectId,
+		PreviousProjectId:  int(args.ProjectId),
+		PreviousGeneration: previousGeneration,
+		Name:               good.Name,
+		Description:        good.Description,
+		Priority:           good.Priority,
+		Removed:            good.Removed,
+		EventTime:          time.Now(),
+		GoodLabels:         good.GoodLabels,
+	})
+
+	return r.written(ctx, good), nil
+}
+
+// written resolves a good returned by a mutation, its fields are loaded like those of a queried good
+func (r *Resolver) written(ctx context.Context, good entity.GoodsForList) *goodResolver {
+	loaders := loadersFrom(ctx)
+	loaders.goods.Set(good.Id, good)
+	loaders.seeGoods(good)
+
+	return &goodResolver{root: r, good: good}
+}
@@ -0,0 +1,307 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	gql "github.com/graph-gophers/graphql-go"
+	"hezzl_test/internal/entity"
+	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/lib/logger/sl"
+	"log/slog"
+)
+
+// JSON is the scalar of the free-form attributes of a good, always an object
+type JSON map[string]any
+
+func (JSON) ImplementsGraphQLType(name string) bool {
+	return name == "JSON"
+}
+
+func (j *JSON) UnmarshalGraphQL(input any) error {
+	object, ok := input.(map[string]any)
+	if !ok {
+		return fmt.Errorf("JSON must be an object, got %T", input)
+	}
+
+	*j = object
+
+	return nil
+}
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if j == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(map[string]any(j))
+}
+
+type projectResolver struct {
+	root    *Resolver
+	project entity.Project
+}
+
+func (p *projectResolver) Id() int32 {
+	return int32(p.project.Id)
+}
+
+func (p *projectResolver) Name() string {
+	return p.project.Name
+}
+
+func (p *projectResolver) CreatedAt() gql.Time {
+	return gql.Time{Time: p.project.CreatedAt}
+}
+
+func (p *projectResolver) Stats(ctx context.Context) (*statsResolver, error) {
+	const op = "graphql.Project.Stats"
+
+	stats, _, err := loadersFrom(ctx).stats.Load(ctx, p.project.Id)
+	if err != nil {
+		return nil, p.root.storageError(ctx, op, err)
+	}
+
+	return &statsResolver{stats: stats}, nil
+}
+
+func (p *projectResolver) Goods(ctx context.Context, args struct {
+	Removed       *bool
+	Limit, Offset int32
+}) (*pageResolver, error) {
+	limit, offset, err := pagination(ctx, args.Limit, args.Offset, maxLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return newProjectPage(ctx, p.root, p.project.Id, args.Removed, limit, offset)
+}
+
+// pageResolver is a page of goods of one project, or of every project if projectId is 0
+type pageResolver struct {
+	root      *Resolver
+	projectId int
+	ids       []int
+	limit     int
+	offset    int
+}
+
+func newProjectPage(ctx context.Context, root *Resolver, projectId int, removed *bool, limit, offset int) (*pageResolver, error) {
+	const op = "graphql.newProjectPage"
+
+	ids, _, err := loadersFrom(ctx).page(removed, limit, offset).Load(ctx, projectId)
+	if err != nil {
+		return nil, root.storageError(ctx, op, err)
+	}
+
+	return &pageResolver{root: root, projectId: projectId, ids: ids, limit: limit, offset: offset}, nil
+}
+
+func (p *pageResolver) Stats(ctx context.Context) (*statsResolver, error) {
+	const op = "graphql.GoodsPage.Stats"
+
+	if p.projectId == 0 {
+		stats, err := p.root.storage.ProjectStats(0)
+		if err != nil {
+			return nil, p.root.storageError(ctx, op, err)
+		}
+
+		return &statsResolver{stats: stats}, nil
+	}
+
+	stats, _, err := loadersFrom(ctx).stats.Load(ctx, p.projectId)
+	if err != nil {
+		return nil, p.root.storageError(ctx, op, err)
+	}
+
+	return &statsResolver{stats: stats}, nil
+}
+
+func (p *pageResolver) Limit() int32 {
+	return int32(p.limit)
+}
+
+func (p *pageResolver) Offset() int32 {
+	return int32(p.offset)
+}
+
+func (p *pageResolver) Items(ctx context.Context) ([]*goodResolver, error) {
+	const op = "graphql.GoodsPage.Items"
+
+	loaders := loadersFrom(ctx)
+
+	items := make([]*goodResolver, 0, len(p.ids))
+	for _, id := range p.ids {
+		good, ok, err := loaders.goods.Load(ctx, id)
+		if err != nil {
+			return nil, p.root.storageError(ctx, op, err)
+		}
+		// a good removed from the database between the two queries is left out
+		if ok {
+			items = append(items, &goodResolver{root: p.root, good: good})
+		}
+	}
+
+	return items, nil
+}
+
+type statsResolver struct {
+	stats entity.ProjectStats
+}
+
+func (s *statsResolver) Total() int32 {
+	return int32(s.stats.Total)
+}
+
+func (s *statsResolver) Active() int32 {
+	return int32(s.stats.Active)
+}
+
+func (s *statsResolver) Removed() int32 {
+	return int32(s.stats.Removed)
+}
+
+type goodResolver struct {
+	root *Resolver
+	good entity.GoodsForList
+}
+
+func (g *goodResolver) Id() int32 {
+	return int32(g.good.Id)
+}
+
+func (g *goodResolver) ProjectId() int32 {
+	return int32(g.good.ProjectId)
+}
+
+func (g *goodResolver) Name() string {
+	return g.good.Name
+}
+
+func (g *goodResolver) Description() string {
+	return g.good.Description
+}
+
+func (g *goodResolver) Priority() int32 {
+	return int32(g.good.Priority)
+}
+
+func (g *goodResolver) Removed() bool {
+	return g.good.Removed
+}
+
+func (g *goodResolver) CreatedAt() gql.Time {
+	return gql.Time{Time: g.good.CreatedAt}
+}
+
+func (g *goodResolver) Tags() []string {
+	if g.good.Tags == nil {
+		return []string{}
+	}
+
+	return g.good.Tags
+}
+
+func (g *goodResolver) Attributes() JSON {
+	return JSON(g.good.Attributes)
+}
+
+func (g *goodResolver) Project(ctx context.Context) (*projectResolver, error) {
+	return g.root.Project(ctx, struct{ Id int32 }{Id: int32(g.good.ProjectId)})
+}
+
+func (g *goodResolver) History(ctx context.Context, args struct{ Limit int32 }) ([]*eventResolver, error) {
+	const op = "graphql.Good.History"
+
+	limit, _, err := pagination(ctx, args.Limit, 0, maxHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	events, _, err := loadersFrom(ctx).historyOf(limit).Load(ctx, g.good.Id)
+	if err != nil {
+		g.root.log.Error("failed to load history", slog.String("op", op), sl.Err(err))
+		return nil, fail(ctx, resp.ErrUnavailable)
+	}
+
+	resolvers := make([]*eventResolver, len(events))
+	for i, event := range events {
+		resolvers[i] = &eventResolver{event: event}
+	}
+
+	return resolvers, nil
+}
+
+type eventResolver struct {
+	event entity.GoodEvent
+}
+
+func (e *eventResolver) EventId() string {
+	return e.event.EventId
+}
+
+func (e *eventResolver) Type() string {
+	return e.event.Type
+}
+
+func (e *eventResolver) ProjectId() int32 {
+	return int32(e.event.ProjectId)
+}
+
+func (e *eventResolver) Name() string {
+	return e.event.Name
+}
+
+func (e *eventResolver) Description() string {
+	return e.event.Description
+}
+
+func (e *eventResolver) Priority() int32 {
+	return int32(e.event.Priority)
+}
+
+func (e *eventResolver) Removed() bool {
+	return e.event.Removed
+}
+
+func (e *eventResolver) EventTime() gql.Time {
+	return gql.Time{Time: e.event.EventTime}
+}
+
+func (e *eventResolver) Changes() *JSON {
+	if e.event.Changes == nil {
+		return nil
+	}
+
+	changes := JSON(e.event.Changes)
+
+	return &changes
+}
+
+type removedResolver struct {
+	response entity.GoodRemoveResponse
+}
+
+func (r *removedResolver) Id() int32 {
+	return int32(r.response.Id)
+}
+
+func (r *removedResolver) ProjectId() int32 {
+	return int32(r.response.ProjectId)
+}
+
+func (r *removedResolver) Removed() bool {
+	return r.response.Removed
+}
+
+type reprioritizedResolver struct {
+	response entity.ReprioritizeResponse
+}
+
+func (r *reprioritizedResolver) Id() int32 {
+	return int32(r.response.Id)
+}
+
+func (r *reprioritizedResolver) Priority() int32 {
+	return int32(r.response.Priority)
+}
@@ -0,0 +1,431 @@
+package goods
+
+import (
+	"context"
+	"errors"
+	"github.com/nats-io/nats.go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	goodsv1 "hezzl_test/api/goods/v1"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/entity"
+	handlers "hezzl_test/internal/http-server/handlers/goods"
+	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/lib/logger/sl"
+	"hezzl_test/internal/lib/validate"
+	natss "hezzl_test/internal/nats"
+	"hezzl_test/internal/storage/postgres"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLimit = 10
+
+	// watchBuffer is how many events a slow watcher may fall behind before its stream is closed
+	watchBuffer = 256
+)
+
+// Server implements the gRPC goods service on top of the storage, cache and events the HTTP handlers use
+type Server struct {
+	goodsv1.UnimplementedGoodsServiceServer
+
+	log        *slog.Logger
+	goods      handlers.Goods
+	goodsCache cache.Cache
+	natsConn   *nats.Conn
+}
+
+func New(log *slog.Logger, goods handlers.Goods, goodsCache cache.Cache, natsConn *nats.Conn) *Server {
+	return &Server{
+		log:        log.With(slog.String("component", "grpc/goods")),
+		goods:      goods,
+		goodsCache: goodsCache,
+		natsConn:   natsConn,
+	}
+}
+
+func (s *Server) CreateGood(ctx context.Context, req *goodsv1.CreateGoodRequest) (*goodsv1.CreateGoodResponse, error) {
+	const op = "grpc.goods.CreateGood"
+
+	create := entity.GoodCreateRequest{Name: req.GetName(), GoodLabels: entity.GoodLabels{Tags: req.GetTags()}}
+	if req.GetAttributes() != nil {
+		create.Attributes = req.GetAttributes().AsMap()
+	}
+	if err := validate.Struct(&create); err != nil {
+		return nil, invalidArgument(err)
+	}
+	if failed := handlers.CheckLabels(&create.GoodLabels, ""); len(failed) > 0 {
+		return nil, invalidArgument(resp.ErrValidationFailed.WithFields(failed...))
+	}
+
+	response, err := s.goods.CreateGood(int(req.GetProjectId()), create.Name, create.GoodLabels)
+	if err != nil {
+		return nil, s.storageError(op, err)
+	}
+
+	handlers.Written(s.log.With(slog.String("op", op)), s.goodsCache, s.natsConn, &entity.GoodEvent{
+		Type:        "created",
+		Id:          response.Id,
+		ProjectId:   response.ProjectId,
+		Name:        response.Name,
+		Description: response.Description,
+		Priority:    response.Priority,
+		Removed:     false,
+		EventTime:   response.CreatedAt,
+		GoodLabels:  response.GoodLabels,
+	})
+
+	return &goodsv1.CreateGoodResponse{Good: toProto(entity.GoodsForList(response))}, nil
+}
+
+func (s *Server) UpdateGood(ctx context.Context, req *goodsv1.UpdateGoodRequest) (*goodsv1.UpdateGoodResponse, error) {
+	const op = "grpc.goods.UpdateGood"
+
+	update := entity.GoodUpdateRequest{Name: req.GetName(), Description: req.GetDescription()}
+	if req.GetTags() != nil {
+		// an empty list clears the tags, so it must not be nil
+		update.Tags = append([]string{}, req.GetTags().GetValues()...)
+	}
+	if req.GetAttributes() != nil {
+		update.Attributes = req.GetAttributes().AsMap()
+	}
+	if err := validate.Struct(&update); err != nil {
+		return nil, invalidArgument(err)
+	}
+	if failed := handlers.CheckLabels(&update.GoodLabels, ""); len(failed) > 0 {
+		return nil, invalidArgument(resp.ErrValidationFailed.WithFields(failed...))
+	}
+
+	response, err := s.goods.UpdateGood(int(req.GetId()), int(req.GetProjectId()), update.Name, update.Description, update.GoodLabels)
+	if err != nil {
+		return nil, s.storageError(op, err)
+	}
+
+	handlers.Written(s.log.With(slog.String("op", op)), s.goodsCache, s.natsConn, &entity.GoodEvent{
+		Type:        "updated",
+		Id:          response.Id,
+		ProjectId:   response.ProjectId,
+		Name:        response.Name,
+		Description: response.Description,
+		Priority:    response.Priority,
+		Removed:     response.Removed,
+		EventTime:   time.Now(),
+		GoodLabels:  response.GoodLabels,
+	})
+
+	return &goodsv1.UpdateGoodResponse{Good: toProto(entity.GoodsForList(response))}, nil
+}
+
+func (s *Server) RemoveGood(ctx context.Context, req *goodsv1.RemoveGoodRequest) (*goodsv1.RemoveGoodResponse, error) {
+	const op = "grpc.goods.RemoveGood"
+
+	response, name, description, priority, labels, err := s.goods.DeleteGood(int(req.GetId()), int(req.GetProjectId()))
+	if err != nil {
+		return nil, s.storageError(op, err)
+	}
+
+	handlers.Written(s.log.With(slog.String("op", op)), s.goodsCache, s.natsConn, &entity.GoodEvent{
+		Type:        "removed",
+		Id:          response.Id,
+		ProjectId:   response.ProjectId,
+		Name:        name,
+		Description: description,
+		Priority:    priority,
+		Removed:     true,
+		EventTime:   time.Now(),
+		GoodLabels:  labels,
+	})
+
+	return &goodsv1.RemoveGoodResponse{
+		Id:        int64(response.Id),
+		ProjectId: int64(response.ProjectId),
+		Removed:   response.Removed,
+	}, nil
+}
+
+func (s *Server) GetGood(ctx context.Context, req *goodsv1.GetGoodRequest) (*goodsv1.GetGoodResponse, error) {
+	const op = "grpc.goods.GetGood"
+
+	good, err := s.goods.GetGoodByID(int(req.GetId()))
+	if err != nil {
+		return nil, s.storageError(op, err)
+	}
+
+	if good.ProjectId != int(req.GetProjectId()) {
+		return nil, status.Error(codes.NotFound, "good not found")
+	}
+
+	return &goodsv1.GetGoodResponse{Good: toProto(good)}, nil
+}
+
+func (s *Server) ListGoods(ctx context.Context, req *goodsv1.ListGoodsRequest) (*goodsv1.ListGoodsResponse, error) {
+	const op = "grpc.goods.ListGoods"
+
+	limit, offset := int(req.GetLimit()), int(req.GetOffset())
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if limit < 0 || offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and offset must not be negative")
+	}
+
+	projectId := int(req.GetProjectId())
+
+	ids, err := s.goods.ListGoodIDs(projectId, req.Removed, limit, offset)
+	if err != nil {
+		return nil, s.storageError(op, err)
+	}
+
+	goodsList, err := s.goods.GetGoodsByIDs(ids)
+	if err != nil {
+		return nil, s.storageError(op, err)
+	}
+
+	stats, err := s.goods.ProjectStats(projectId)
+	if err != nil {
+		return nil, s.storageError(op, err)
+	}
+
+	byId := make(map[int]entity.GoodsForList, len(goodsList))
+	for _, good := range goodsList {
+		byId[good.Id] = good
+	}
+
+	response := &goodsv1.ListGoodsResponse{
+		Meta: &goodsv1.ListMeta{
+			Total:   int64(stats.Total),
+			Active:  int64(stats.Active),
+			Removed: int64(stats.Removed),
+			Limit:   int32(limit),
+			Offset:  int32(offset),
+		},
+		Goods: make([]*goodsv1.Good, 0, len(ids)),
+	}
+	for _, id := range ids {
+		if good, ok := byId[id]; ok {
+			response.Goods = append(response.Goods, toProto(good))
+		}
+	}
+
+	return response, nil
+}
+
+func (s *Server) ReprioritizeGood(ctx context.Context, req *goodsv1.ReprioritizeGoodRequest) (*goodsv1.ReprioritizeGoodResponse, error) {
+	const op = "grpc.goods.ReprioritizeGood"
+
+	id, projectId, priority := int(req.GetId()), int(req.GetProjectId()), int(req.GetNewPriority())
+
+	if err := validate.Struct(&entity.ReprioritizeRequest{NewPriority: priority}); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	name, description, labels, err := s.goods.Reprioritize(id, projectId, priority)
+	if err != nil {
+		return nil, s.storageError(op, err)
+	}
+
+	handlers.Written(s.log.With(slog.String("op", op)), s.goodsCache, s.natsConn, &entity.GoodEvent{
+		Type:        "reprioritized",
+		Id:          id,
+		ProjectId:   projectId,
+		Name:        name,
+		Description: description,
+		Priority:    priority,
+		Removed:     false,
+		EventTime:   time.Now(),
+		GoodLabels:  labels,
+	})
+
+	return &goodsv1.ReprioritizeGoodResponse{Id: int64(id), Priority: int64(priority)}, nil
+}
+
+func (s *Server) MoveGood(ctx context.Context, req *goodsv1.MoveGoodRequest) (*goodsv1.MoveGoodResponse, error) {
+	const op = "grpc.goods.MoveGood"
+
+	if err := validate.Struct(&entity.MoveRequest{NewProjectId: int(req.GetNewProjectId())}); err != nil {
+		return nil, invalidArgument(err)
+	}
+	if req.GetNewProjectId() == req.GetProjectId() {
+		return nil, status.Error(codes.InvalidArgument, "good is already in the project")
+	}
+
+	good, err := s.goods.MoveGood(int(req.GetId()), int(req.GetProjectId()), int(req.GetNewProjectId()))
+	if err != nil {
+		return nil, s.storageError(op, err)
+	}
+
+	// the good left one project and joined another, both are cached separately
+	previousGeneration, err := handlers.InvalidateRedisCache(s.goodsCache, s.natsConn, int(req.GetProjectId()))
+	if err != nil {
+		s.log.Error("Redis cache invalidation error", slog.String("op", op), sl.Err(err))
+	}
+
+	handlers.Written(s.log.With(slog.String("op", op)), s.goodsCache, s.natsConn, &entity.GoodEvent{
+		Type:               "moved",
+		Id:                 good.Id,
+		ProjectId:          good.ProjectId,
+		PreviousProjectId:  int(req.GetProjectId()),
+		PreviousGeneration: previousGeneration,
+		Name:               good.Name,
+		Description:        good.Description,
+		Priority:           good.Priority,
+		Removed:            good.Removed,
+		EventTime:          time.Now(),
+		GoodLabels:         good.GoodLabels,
+	})
+
+	return &goodsv1.MoveGoodResponse{Good: toProto(good)}, nil
+}
+
+func (s *Server) WatchGoods(req *goodsv1.WatchGoodsRequest, stream goodsv1.GoodsService_WatchGoodsServer) error {
+	const op = "grpc.goods.WatchGoods"
+
+	types := make(map[string]bool, len(req.GetTypes()))
+	for _, eventType := range req.GetTypes() {
+		types[eventType] = true
+	}
+
+	events := make(chan entity.GoodEvent, watchBuffer)
+	overflow := make(chan struct{})
+
+	sub, err := natss.WatchEvents(s.natsConn, func(event entity.GoodEvent) {
+		// a good moved away from the project is reported too, its previous project is the watched one
+		if projectId := req.GetProjectId(); projectId != 0 && int64(event.ProjectId) != projectId && int64(event.PreviousProjectId) != projectId {
+			return
+		}
+		if len(types) > 0 && !types[event.Type] {
+			return
+		}
+
+		select {
+		case events <- event:
+		default:
+			// the subscription delivers messages one at a time, so overflow is closed at most once
+			select {
+			case <-overflow:
+			default:
+				close(overflow)
+			}
+		}
+	})
+	if err != nil {
+		s.log.Error("failed to watch events", slog.String("op", op), sl.Err(err))
+		return status.Error(codes.Unavailable, "events are unavailable")
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-overflow:
+			return status.Error(codes.ResourceExhausted, "watcher fell too far behind")
+		case event := <-events:
+			if err := stream.Send(&goodsv1.WatchGoodsResponse{Event: eventToProto(event)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// storageError maps storage errors to gRPC status codes, unexpected errors are logged and hidden
+func (s *Server) storageError(op string, err error) error {
+	switch {
+	case errors.Is(err, postgres.ErrNotFound):
+		return status.Error(codes.NotFound, "good not found")
+	case errors.Is(err, postgres.ErrProjectNotFound):
+		return status.Error(codes.NotFound, "project not found")
+	case errors.Is(err, postgres.ErrGoodsQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, "goods quota exceeded")
+	case errors.Is(err, postgres.ErrReprioritizeQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, "reprioritize quota exceeded")
+	}
+
+	var rangeErr *postgres.PriorityRangeError
+	if errors.As(err, &rangeErr) {
+		return status.Error(codes.InvalidArgument, rangeErr.Error())
+	}
+
+	s.log.Error("storage error", slog.String("op", op), sl.Err(err))
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// invalidArgument lists the failed field rules of a validation error in the status message
+func invalidArgument(err error) error {
+	var apiErr *resp.Error
+	if !errors.As(err, &apiErr) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	fields := apiErr.FieldMessages("en")
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+
+	return status.Error(codes.InvalidArgument, strings.Join(messages, "; "))
+}
+
+func toProto(good entity.GoodsForList) *goodsv1.Good {
+	return &goodsv1.Good{
+		Id:          int64(good.Id),
+		ProjectId:   int64(good.ProjectId),
+		Name:        good.Name,
+		Description: good.Description,
+		Priority:    int64(good.Priority),
+		Removed:     good.Removed,
+		CreatedAt:   timestamppb.New(good.CreatedAt),
+		Tags:        good.Tags,
+		Attributes:  attributesToProto(good.Attributes),
+	}
+}
+
+func eventToProto(event entity.GoodEvent) *goodsv1.GoodEvent {
+	var changed []string
+	if event.Type == entity.PatchedEvent {
+		good := entity.GoodsForList{}
+		if err := entity.ApplyChanges(&good, event.Changes); err == nil {
+			event.Name, event.Description, event.GoodLabels = good.Name, good.Description, good.GoodLabels
+		}
+		for field := range event.Changes {
+			changed = append(changed, field)
+		}
+		sort.Strings(changed)
+	}
+
+	return &goodsv1.GoodEvent{
+		EventId:           event.EventId,
+		Type:              event.Type,
+		Id:                int64(event.Id),
+		ProjectId:         int64(event.ProjectId),
+		Name:              event.Name,
+		Description:       event.Description,
+		Priority:          int64(event.Priority),
+		Removed:           event.Removed,
+		EventTime:         timestamppb.New(event.EventTime),
+		PreviousProjectId: int64(event.PreviousProjectId),
+		Tags:              event.Tags,
+		Attributes:        attributesToProto(event.Attributes),
+		ChangedFields:     changed,
+	}
+}
+
+// attributesToProto converts the attributes of a good, they are decoded JSON, so every value converts
+func attributesToProto(attributes map[string]any) *structpb.Struct {
+	if attributes == nil {
+		return nil
+	}
+
+	converted, err := structpb.NewStruct(attributes)
+	if err != nil {
+		return nil
+	}
+
+	return converted
+}
@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"time"
+)
+
+// Unary logs every unary call the way the HTTP logger middleware logs requests
+func Unary(log *slog.Logger) grpc.UnaryServerInterceptor {
+	log = log.With(slog.String("component", "grpc/logger"))
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		t1 := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		log.Info("call completed",
+			slog.String("method", info.FullMethod),
+			slog.String("code", status.Code(err).String()),
+			slog.String("duration", time.Since(t1).String()),
+		)
+
+		return resp, err
+	}
+}
+
+// Stream logs every streaming call once it ends
+func Stream(log *slog.Logger) grpc.StreamServerInterceptor {
+	log = log.With(slog.String("component", "grpc/logger"))
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		t1 := time.Now()
+
+		err := handler(srv, ss)
+
+		log.Info("stream completed",
+			slog.String("method", info.FullMethod),
+			slog.String("code", status.Code(err).String()),
+			slog.String("duration", time.Since(t1).String()),
+		)
+
+		return err
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"hezzl_test/internal/http-server/middleware/ratelimit"
+	"hezzl_test/internal/lib/logger/sl"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Method is the method routes are configured with to limit gRPC calls, their pattern is the full method name
+const Method = "GRPC"
+
+type projectRequest interface {
+	GetProjectId() int64
+}
+
+// Interceptors count gRPC calls in the windows the HTTP API uses, so the limits hold whichever API a client picks
+type Interceptors struct {
+	log     *slog.Logger
+	limiter *ratelimit.Limiter
+	header  string
+}
+
+// New reads the client key from the header metadata, the one the HTTP API reads it from
+func New(log *slog.Logger, limiter *ratelimit.Limiter, header string) *Interceptors {
+	return &Interceptors{
+		log:     log.With(slog.String("component", "grpc/ratelimit")),
+		limiter: limiter,
+		header:  strings.ToLower(header),
+	}
+}
+
+// Unary counts every unary call, in the project window too when the request names a project
+func (i *Interceptors) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := i.take(ctx, req, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// Stream counts a streaming call once, when it is opened
+func (i *Interceptors) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := i.take(ss.Context(), nil, info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func (i *Interceptors) take(ctx context.Context, req any, fullMethod string) error {
+	var key, addr, projectId string
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok && i.header != "" {
+		if values := md.Get(i.header); len(values) > 0 {
+			key = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	if r, ok := req.(projectRequest); ok && r.GetProjectId() != 0 {
+		projectId = strconv.FormatInt(r.GetProjectId(), 10)
+	}
+
+	allowed, reset, err := i.limiter.Take(ctx, key, addr, projectId, Method, fullMethod)
+	if err != nil {
+		// Redis being down must not take the API down with it
+		i.log.Warn("rate limit check failed, call allowed", sl.Err(err))
+		return nil
+	}
+
+	if !allowed {
+		_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int((reset+time.Second-1)/time.Second))))
+		return status.Error(codes.ResourceExhausted, "too many requests, retry later")
+	}
+
+	return nil
+}
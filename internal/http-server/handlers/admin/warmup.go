@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/lib/logger/sl"
+	"hezzl_test/internal/lib/validate"
+	"hezzl_test/internal/warmup"
+	"log/slog"
+	"net/http"
+)
+
+// ProjectSelector returns the top most active projects
+type ProjectSelector func(ctx context.Context, top int) ([]int, error)
+
+// WarmupRequest overrides the configured projects, both fields are optional
+type WarmupRequest struct {
+	Projects []int `json:"projects"`
+	Top      int   `json:"top" validate:"min=0"`
+}
+
+// StartWarmup starts a cache warm-up in the background and answers with its status right away
+func StartWarmup(log *slog.Logger, job *warmup.Job, selectProjects ProjectSelector, defaults warmup.Options, defaultTop int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.StartWarmup"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req WarmupRequest
+
+		// the body is optional
+		err := validate.DecodeJSON(r.Body, &req)
+		if err != nil && !errors.Is(err, resp.ErrEmptyBody) {
+			log.Info("invalid request body", sl.Err(err))
+			resp.Fail(w, r, err)
+			return
+		}
+
+		opts := defaults
+		if len(req.Projects) > 0 {
+			opts.Projects = req.Projects
+		}
+
+		if len(opts.Projects) == 0 {
+			top := defaultTop
+			if req.Top > 0 {
+				top = req.Top
+			}
+
+			if opts.Projects, err = selectProjects(r.Context(), top); err != nil {
+				log.Error("failed to select projects", sl.Err(err))
+				resp.Fail(w, r, resp.ErrUnavailable)
+				return
+			}
+		}
+
+		status, err := job.Start(opts)
+		if errors.Is(err, warmup.ErrRunning) {
+			resp.Fail(w, r, resp.ErrWarmupRunning.With("status", status))
+			return
+		}
+
+		log.Info("cache warm-up started", slog.Int("projects", len(opts.Projects)))
+
+		w.WriteHeader(http.StatusAccepted)
+		render.JSON(w, r, status)
+	}
+}
+
+// WarmupStatus reports the progress of the running or the last warm-up
+func WarmupStatus(job *warmup.Job) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, job.Status())
+	}
+}
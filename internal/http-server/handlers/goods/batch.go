@@ -0,0 +1,318 @@
+package goods
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/nats-io/nats.go"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/entity"
+	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/lib/logger/sl"
+	"hezzl_test/internal/lib/validate"
+	natss "hezzl_test/internal/nats"
+	"hezzl_test/internal/storage/postgres"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxBatchOperations is the most operations a batch may have
+const maxBatchOperations = 100
+
+// batchOps are the operations of a batch with the status and the event type of their success
+var batchOps = map[string]struct {
+	status int
+	event  string
+}{
+	"create":       {http.StatusCreated, "created"},
+	"update":       {http.StatusOK, "updated"},
+	"remove":       {http.StatusOK, "removed"},
+	"reprioritize": {http.StatusOK, "reprioritized"},
+	"move":         {http.StatusOK, "moved"},
+}
+
+type Batcher interface {
+	Batch(ops []entity.BatchOperation, atomic bool) ([]postgres.BatchResult, error)
+}
+
+// OperationLimiter counts the operations of a batch in the rate limit windows of the routes they stand for
+type OperationLimiter interface {
+	TakeOperations(r *http.Request, counts map[string]int) (bool, time.Duration, error)
+}
+
+// batchResponse response for batch request, results are in the order of the operations
+type batchResponse struct {
+	Atomic  bool          `json:"atomic"`
+	Results []batchResult `json:"results"`
+}
+
+// batchResult is the outcome of an operation, the good after it or the error it failed with
+type batchResult struct {
+	Index  int                  `json:"index"`
+	Op     string               `json:"op"`
+	Status int                  `json:"status"`
+	Good   *entity.GoodsForList `json:"good,omitempty"`
+	Error  *resp.ErrorResponse  `json:"error,omitempty"`
+}
+
+// Batch runs several writes in one transaction and answers with the result of every operation.
+// An atomic batch, the default, fails as a whole with the error of the operation that failed.
+// Caches are invalidated and events published only once the transaction is committed.
+// Every operation is counted in the rate limit window of its route, creates in the one of create and so on.
+func Batch(log *slog.Logger, batcher Batcher, goodsCache cache.Cache, natsConn *nats.Conn, limiter OperationLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goods.Batch"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req entity.BatchRequest
+
+		if err := validate.DecodeJSON(r.Body, &req); err != nil {
+			log.Info("invalid request body", sl.Err(err))
+			resp.Fail(w, r, err)
+			return
+		}
+
+		if err := validateBatch(req.Operations); err != nil {
+			log.Info("invalid batch", sl.Err(err))
+			resp.Fail(w, r, err)
+			return
+		}
+
+		counts := make(map[string]int)
+		for _, operation := range req.Operations {
+			counts[operation.Op]++
+		}
+
+		allowed, reset, err := limiter.TakeOperations(r, counts)
+		if err != nil {
+			// Redis being down must not take the API down with it
+			log.Warn("rate limit check failed, batch allowed", sl.Err(err))
+		} else if !allowed {
+			log.Info("batch operations rate limited")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+			resp.Fail(w, r, resp.ErrRateLimited)
+			return
+		}
+
+		atomic := req.Atomic == nil || *req.Atomic
+
+		results, err := batcher.Batch(req.Operations, atomic)
+		if err != nil {
+			var batchErr *postgres.BatchError
+			if !errors.As(err, &batchErr) {
+				failStorage(w, r, log, "failed to run batch", err)
+				return
+			}
+
+			// the batch was rolled back, the error names the operation that failed
+			apiErr := StorageError(batchErr.Err)
+			if errors.Is(apiErr, resp.ErrInternal) {
+				log.Error("batch operation failed", slog.Int("index", batchErr.Index), sl.Err(batchErr.Err))
+			}
+			resp.Fail(w, r, apiErr.With("operation", batchErr.Index))
+			return
+		}
+
+		log.Info("batch committed", slog.Int("operations", len(results)))
+
+		response := batchResponse{
+			Atomic:  atomic,
+			Results: make([]batchResult, len(results)),
+		}
+
+		var events []*entity.GoodEvent
+		var projects []int
+
+		for i, result := range results {
+			operation := req.Operations[i]
+			response.Results[i] = batchResult{Index: i, Op: operation.Op}
+
+			if result.Err != nil {
+				apiErr := StorageError(result.Err)
+				if errors.Is(apiErr, resp.ErrInternal) {
+					log.Error("batch operation failed", slog.Int("index", i), sl.Err(result.Err))
+				}
+
+				status, body := resp.Body(r, apiErr)
+				response.Results[i].Status = status
+				response.Results[i].Error = &body
+				continue
+			}
+
+			good := result.Good
+			response.Results[i].Status = batchOps[operation.Op].status
+			response.Results[i].Good = &good
+
+			events = append(events, batchEvent(operation.Op, result))
+			projects = appendProject(projects, good.ProjectId)
+			if result.PreviousProjectId != 0 {
+				projects = appendProject(projects, result.PreviousProjectId)
+			}
+		}
+
+		generations := make(map[int]int64, len(projects))
+		for _, project := range projects {
+			generation, err := InvalidateRedisCache(goodsCache, natsConn, project)
+			if err != nil {
+				log.Error("Redis cache invalidation error", sl.Err(err))
+			}
+			generations[project] = generation
+		}
+		stampGenerations(events, generations)
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+
+		for _, event := range events {
+			if err := natss.PublishEvent(natsConn, event); err != nil {
+				log.Error("Error sending message to NATS", sl.Err(err))
+				return
+			}
+		}
+
+		log.Info("messages sended to NATS", slog.Int("events", len(events)))
+	}
+}
+
+// stampGenerations gives the generation of every project to the last event that touches it,
+// the rank index must not serve the project before all events of the batch are applied
+func stampGenerations(events []*entity.GoodEvent, generations map[int]int64) {
+	stamped := make(map[int]bool, len(generations))
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if !stamped[event.ProjectId] {
+			event.Generation = generations[event.ProjectId]
+			stamped[event.ProjectId] = true
+		}
+		if event.PreviousProjectId != 0 && !stamped[event.PreviousProjectId] {
+			event.PreviousGeneration = generations[event.PreviousProjectId]
+			stamped[event.PreviousProjectId] = true
+		}
+	}
+}
+
+// validateBatch checks what every operation needs, fields are named by their place in the request,
+// as in operations.1.name
+func validateBatch(ops []entity.BatchOperation) error {
+	if len(ops) == 0 {
+		return resp.ErrValidationFailed.WithFields(resp.FieldError{Field: "operations", Rule: "required"})
+	}
+	if len(ops) > maxBatchOperations {
+		return resp.ErrValidationFailed.WithFields(resp.FieldError{
+			Field: "operations",
+			Rule:  "maxitems",
+			Param: strconv.Itoa(maxBatchOperations),
+		})
+	}
+
+	var failed []resp.FieldError
+	for i := range ops {
+		operation := &ops[i]
+		prefix := fmt.Sprintf("operations.%d.", i)
+
+		fail := func(field, rule, param string) {
+			failed = append(failed, resp.FieldError{Field: prefix + field, Rule: rule, Param: param})
+		}
+
+		if err := validate.Struct(operation); err != nil {
+			var apiErr *resp.Error
+			if errors.As(err, &apiErr) {
+				for _, field := range apiErr.Fields {
+					fail(field.Field, field.Rule, field.Param)
+				}
+			}
+			continue
+		}
+
+		for _, field := range CheckLabels(&operation.GoodLabels, "") {
+			fail(field.Field, field.Rule, field.Param)
+		}
+
+		if _, ok := batchOps[operation.Op]; !ok {
+			fail("op", "oneof", "create, update, remove, reprioritize, move")
+			continue
+		}
+
+		switch {
+		case operation.Op == "create":
+			if operation.ProjectId == 0 {
+				fail("projectId", "required", "")
+			}
+		case operation.Ref != nil:
+			if *operation.Ref >= i {
+				fail("ref", "ref", "")
+			}
+		default:
+			if operation.Id == 0 {
+				fail("id", "required", "")
+			}
+			if operation.ProjectId == 0 {
+				fail("projectId", "required", "")
+			}
+		}
+
+		switch operation.Op {
+		case "create", "update":
+			if operation.Name == nil || *operation.Name == "" {
+				fail("name", "required", "")
+			}
+		case "reprioritize":
+			if operation.NewPriority == nil {
+				fail("newPriority", "required", "")
+			}
+		case "move":
+			if operation.NewProjectId == nil {
+				fail("newProjectId", "required", "")
+			} else if operation.Ref == nil && *operation.NewProjectId == operation.ProjectId {
+				fail("newProjectId", "changed", "")
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return resp.ErrValidationFailed.WithFields(failed...)
+	}
+
+	return nil
+}
+
+// batchEvent is the event of a committed operation, it carries the good after the operation
+func batchEvent(op string, result postgres.BatchResult) *entity.GoodEvent {
+	good := result.Good
+
+	event := &entity.GoodEvent{
+		Type:              batchOps[op].event,
+		Id:                good.Id,
+		ProjectId:         good.ProjectId,
+		PreviousProjectId: result.PreviousProjectId,
+		Name:              good.Name,
+		Description:       good.Description,
+		Priority:          good.Priority,
+		Removed:           good.Removed,
+		EventTime:         time.Now(),
+		GoodLabels:        good.GoodLabels,
+	}
+	if op == "create" {
+		event.EventTime = good.CreatedAt
+	}
+
+	return event
+}
+
+func appendProject(projects []int, projectId int) []int {
+	for _, project := range projects {
+		if project == projectId {
+			return projects
+		}
+	}
+
+	return append(projects, projectId)
+}
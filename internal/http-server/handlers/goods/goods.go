@@ -9,28 +9,36 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/nats-io/nats.go"
-	"github.com/redis/go-redis/v9"
+	"hezzl_test/internal/cache"
 	"hezzl_test/internal/entity"
+	"hezzl_test/internal/http-server/middleware/version"
 	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/lib/logger/sl"
+	"hezzl_test/internal/lib/validate"
+	natss "hezzl_test/internal/nats"
 	"hezzl_test/internal/storage/postgres"
-	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 )
 
 type Goods interface {
-	CreateGood(projectId int, name string) (entity.GoodCreateResponse, error)
-	UpdateGood(id, projectId int, name, description string) (entity.GoodUpdateResponse, error)
-	DeleteGood(id, projectId int) (entity.GoodRemoveResponse, string, string, int, error)
+	CreateGood(projectId int, name string, labels entity.GoodLabels) (entity.GoodCreateResponse, error)
+	UpdateGood(id, projectId int, name, description string, labels entity.GoodLabels) (entity.GoodUpdateResponse, error)
+	PatchGood(id, projectId int, apply func(entity.GoodDocument) (entity.GoodDocument, error)) (entity.GoodDocument, entity.GoodDocument, error)
+	DeleteGood(id, projectId int) (entity.GoodRemoveResponse, string, string, int, entity.GoodLabels, error)
 	GetGoodByID(key int) (entity.GoodsForList, error)
-	CalculateTotalAndRemoved() (int, int, error)
-	Reprioritize(goodID, projectID, newPriority int) (string, string, error)
+	GetGoodsByIDs(ids []int) ([]entity.GoodsForList, error)
+	ListGoodIDs(projectId int, removed *bool, limit, offset int) ([]int, error)
+	FilterGoodIDs(projectId int, removed *bool, filter entity.GoodsFilter, limit, offset int) ([]int, error)
+	ProjectStats(projectId int) (entity.ProjectStats, error)
+	Reprioritize(goodID, projectID, newPriority int) (string, string, entity.GoodLabels, error)
+	MoveGood(id, projectId, newProjectId int) (entity.GoodsForList, error)
 }
 
-func Create(log *slog.Logger, goods Goods, natsConn *nats.Conn) http.HandlerFunc {
+func Create(log *slog.Logger, goods Goods, goodsCache cache.Cache, natsConn *nats.Conn) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goods.Create"
 
@@ -42,70 +50,66 @@ func Create(log *slog.Logger, goods Goods, natsConn *nats.Conn) http.HandlerFunc
 		projectId := chi.URLParam(r, "projectId")
 		if projectId == "" {
 			log.Info("project id is empty")
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, resp.Error("project id parameter is required"))
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
 			return
 		}
 
 		projectIdInt, err := strconv.Atoi(projectId)
 		if err != nil {
-			http.Error(w, "Invalid project ID", http.StatusBadRequest)
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
 			return
 		}
 
 		var req entity.GoodCreateRequest
 
-		err = render.DecodeJSON(r.Body, &req)
-		if errors.Is(err, io.EOF) {
-			log.Error("request body is empty")
-
-			render.JSON(w, r, resp.Error("empty request"))
-
+		if err := validate.DecodeJSON(r.Body, &req); err != nil {
+			log.Info("invalid request body", sl.Err(err))
+			resp.Fail(w, r, err)
 			return
 		}
-		if err != nil {
-			log.Error("failed to decode request body: ", err)
-
-			render.JSON(w, r, resp.Error("failed to decode request"))
 
+		if failed := CheckLabels(&req.GoodLabels, ""); len(failed) > 0 {
+			log.Info("invalid labels", slog.Int("fields", len(failed)))
+			resp.Fail(w, r, resp.ErrValidationFailed.WithFields(failed...))
 			return
 		}
 
 		log.Info("request body decoded", slog.Any("request", req))
 
-		response, err := goods.CreateGood(projectIdInt, req.Name)
+		response, err := goods.CreateGood(projectIdInt, req.Name, req.GoodLabels)
 		if err != nil {
-			log.Error("failed to create good: ", err)
-
-			render.JSON(w, r, resp.Error("internal error"))
-
+			failStorage(w, r, log, "failed to create good", err)
 			return
 		}
 
 		log.Info("good created")
 
+		generation, err := InvalidateRedisCache(goodsCache, natsConn, projectIdInt)
+		if err != nil {
+			log.Error("Redis cache invalidation error", sl.Err(err))
+		}
+
+		if version.From(r.Context()) == version.V2 {
+			w.Header().Set("Location", goodLocation(response.ProjectId, response.Id))
+		}
 		w.WriteHeader(http.StatusCreated)
 		render.JSON(w, r, response)
 
 		event := &entity.GoodEvent{
+			Type:        "created",
 			Id:          response.Id,
 			ProjectId:   response.ProjectId,
+			Generation:  generation,
 			Name:        response.Name,
 			Description: response.Description,
 			Priority:    response.Priority,
 			Removed:     false,
 			EventTime:   response.CreatedAt,
+			GoodLabels:  response.GoodLabels,
 		}
 
-		eventData, err := json.Marshal(event)
-		if err != nil {
-			log.Error("Error marshaling message: ", err)
-			return
-		}
-
-		err = natsConn.Publish("goods.created", eventData)
-		if err != nil {
-			log.Error("Error sending message to NATS: ", err)
+		if err := natss.PublishEvent(natsConn, event); err != nil {
+			log.Error("Error sending message to NATS", sl.Err(err))
 			return
 		}
 
@@ -113,7 +117,9 @@ func Create(log *slog.Logger, goods Goods, natsConn *nats.Conn) http.HandlerFunc
 	}
 }
 
-func Update(log *slog.Logger, goods Goods, redisClient *redis.Client, natsConn *nats.Conn) http.HandlerFunc {
+// Update replaces the name and the description of a good, a JSON Merge Patch or a JSON Patch body
+// changes only the fields it touches
+func Update(log *slog.Logger, goods Goods, goodsCache cache.Cache, natsConn *nats.Conn) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goods.Update"
 
@@ -125,117 +131,89 @@ func Update(log *slog.Logger, goods Goods, redisClient *redis.Client, natsConn *
 		projectId := chi.URLParam(r, "projectId")
 		if projectId == "" {
 			log.Info("project id is empty")
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, resp.Error("project id parameter is required"))
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
 			return
 		}
 
 		id := chi.URLParam(r, "id")
 		if projectId == "" {
 			log.Info("id is empty")
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, resp.Error("id parameter is required"))
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "id"))
 			return
 		}
 
 		projectIdInt, err := strconv.Atoi(projectId)
 		if err != nil {
-			http.Error(w, "Invalid project ID", http.StatusBadRequest)
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
 			return
 		}
 
 		idInt, err := strconv.Atoi(id)
 		if err != nil {
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "id"))
 			return
 		}
 
-		var req entity.GoodUpdateRequest
-
-		err = render.DecodeJSON(r.Body, &req)
-		if errors.Is(err, io.EOF) {
-			log.Error("request body is empty")
-
-			render.JSON(w, r, resp.Error("empty request"))
-
+		if format := patchFormat(r); format != "" {
+			patchGood(w, r, log, goods, goodsCache, natsConn, format, idInt, projectIdInt)
 			return
 		}
-		if err != nil {
-			log.Error("failed to decode request body: ", err)
 
-			render.JSON(w, r, resp.Error("failed to decode request"))
+		var req entity.GoodUpdateRequest
 
+		if err := validate.DecodeJSON(r.Body, &req); err != nil {
+			log.Info("invalid request body", sl.Err(err))
+			resp.Fail(w, r, err)
 			return
 		}
 
-		log.Info("request body decoded", slog.Any("request", req))
-
-		if req.Name == "" {
-			log.Error("failed to update good: name is cant be empty")
-
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, resp.Error("name is cant be empty"))
-
+		if failed := CheckLabels(&req.GoodLabels, ""); len(failed) > 0 {
+			log.Info("invalid labels", slog.Int("fields", len(failed)))
+			resp.Fail(w, r, resp.ErrValidationFailed.WithFields(failed...))
 			return
 		}
 
-		response, err := goods.UpdateGood(idInt, projectIdInt, req.Name, req.Description)
-		if err != nil {
-			if err == postgres.ErrNotFound {
-				w.WriteHeader(http.StatusNotFound)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"code":    3,
-					"message": "errors.good.notFound",
-					"details": map[string]string{},
-				})
-				return
-			}
-			log.Error("failed to update good: ", err)
-
-			render.JSON(w, r, resp.Error("internal error"))
+		log.Info("request body decoded", slog.Any("request", req))
 
+		response, err := goods.UpdateGood(idInt, projectIdInt, req.Name, req.Description, req.GoodLabels)
+		if err != nil {
+			failStorage(w, r, log, "failed to update good", err)
 			return
 		}
 
 		log.Info("good updated")
 
+		generation, err := InvalidateRedisCache(goodsCache, natsConn, projectIdInt)
+		if err != nil {
+			log.Error("Redis cache invalidation error", sl.Err(err))
+		}
+
 		w.WriteHeader(http.StatusOK)
 		render.JSON(w, r, response)
 
 		event := &entity.GoodEvent{
+			Type:        "updated",
 			Id:          response.Id,
 			ProjectId:   response.ProjectId,
+			Generation:  generation,
 			Name:        response.Name,
 			Description: response.Description,
 			Priority:    response.Priority,
 			Removed:     false,
 			EventTime:   time.Now(),
+			GoodLabels:  response.GoodLabels,
 		}
 
-		eventData, err := json.Marshal(event)
-		if err != nil {
-			log.Error("Error marshaling message: ", err)
-			return
-		}
-
-		err = natsConn.Publish("goods.updated", eventData)
-		if err != nil {
-			log.Error("Error sending message to NATS: ", err)
+		if err := natss.PublishEvent(natsConn, event); err != nil {
+			log.Error("Error sending message to NATS", sl.Err(err))
 			return
 		}
 
 		log.Info("message sended to NATS")
-
-		err = InvalidateRedisCache(redisClient, idInt)
-		if err != nil {
-			log.Error("Redis cache invalidation error: ", err)
-		}
-
-		log.Info("good deleted from REDIS")
 	}
 }
 
-func Remove(log *slog.Logger, goods Goods, redisClient *redis.Client, natsConn *nats.Conn) http.HandlerFunc {
+func Remove(log *slog.Logger, goods Goods, goodsCache cache.Cache, natsConn *nats.Conn) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goods.Remove"
 
@@ -247,88 +225,76 @@ func Remove(log *slog.Logger, goods Goods, redisClient *redis.Client, natsConn *
 		projectId := chi.URLParam(r, "projectId")
 		if projectId == "" {
 			log.Info("project id is empty")
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, resp.Error("project id parameter is required"))
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
 			return
 		}
 
 		id := chi.URLParam(r, "id")
 		if id == "" {
 			log.Info("id is empty")
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, resp.Error("id parameter is required"))
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "id"))
 			return
 		}
 
 		projectIdInt, err := strconv.Atoi(projectId)
 		if err != nil {
-			http.Error(w, "invalid project ID", http.StatusBadRequest)
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
 			return
 		}
 
 		idInt, err := strconv.Atoi(id)
 		if err != nil {
-			http.Error(w, "invalid ID", http.StatusBadRequest)
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "id"))
 			return
 		}
 
-		response, name, description, priority, err := goods.DeleteGood(idInt, projectIdInt)
+		response, name, description, priority, labels, err := goods.DeleteGood(idInt, projectIdInt)
 		if err != nil {
-			if err == postgres.ErrNotFound {
-				w.WriteHeader(http.StatusNotFound)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"code":    3,
-					"message": "errors.good.notFound",
-					"details": map[string]string{},
-				})
-				return
-			}
-			log.Error("failed to remove good: ", err)
-
-			render.JSON(w, r, resp.Error("internal error"))
-
+			failStorage(w, r, log, "failed to remove good", err)
 			return
 		}
 
 		log.Info("good removed")
 
-		w.WriteHeader(http.StatusOK)
-		render.JSON(w, r, response)
+		generation, err := InvalidateRedisCache(goodsCache, natsConn, projectIdInt)
+		if err != nil {
+			log.Error("Redis cache invalidation error", sl.Err(err))
+		}
+
+		// v2 answers a removal with no content, v1 clients expect the removed good
+		if version.From(r.Context()) == version.V2 {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			render.JSON(w, r, response)
+		}
 
 		event := &entity.GoodEvent{
+			Type:        "removed",
 			Id:          response.Id,
 			ProjectId:   response.ProjectId,
+			Generation:  generation,
 			Name:        name,
 			Description: description,
 			Priority:    priority,
 			Removed:     true,
 			EventTime:   time.Now(),
+			GoodLabels:  labels,
 		}
 
-		eventData, err := json.Marshal(event)
-		if err != nil {
-			log.Error("Error marshaling message: ", err)
-			return
-		}
-
-		err = natsConn.Publish("goods.removed", eventData)
-		if err != nil {
-			log.Error("Error sending message to NATS: ", err)
+		if err := natss.PublishEvent(natsConn, event); err != nil {
+			log.Error("Error sending message to NATS", sl.Err(err))
 			return
 		}
 
 		log.Info("message sended to NATS")
-
-		err = InvalidateRedisCache(redisClient, idInt)
-		if err != nil {
-			log.Error("Redis cache invalidation error: ", err)
-		}
-
-		log.Info("good deleted from REDIS")
 	}
 }
 
-func List(log *slog.Logger, goods Goods, redisClient *redis.Client) http.HandlerFunc {
+func List(log *slog.Logger, goods Goods, goodsCache cache.Cache, index *cache.RankIndex) http.HandlerFunc {
+	// pages are rebuilt by one caller at a time, concurrent requests wait for it or get the previous page
+	loader := cache.NewLoader(goodsCache)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goods.List"
 
@@ -338,94 +304,313 @@ func List(log *slog.Logger, goods Goods, redisClient *redis.Client) http.Handler
 		)
 
 		var (
-			limitInt  int
-			offsetInt int
+			limitInt     int
+			offsetInt    int
+			projectIdInt int
+			err          error
 		)
 
 		limit := r.URL.Query().Get("limit")
 		if limit == "" {
 			limitInt = 10
 			log.Info("limit is set to 10")
-		} else {
-			limitInt, _ = strconv.Atoi(limit)
+		} else if limitInt, err = strconv.Atoi(limit); err != nil || limitInt <= 0 {
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "limit"))
+			return
 		}
 
 		offset := r.URL.Query().Get("offset")
 		if offset == "" {
-			offsetInt = 1
-			log.Info("offset is set to 1")
-		} else {
-			offsetInt, _ = strconv.Atoi(offset)
-		}
-
-		keys := make([]string, limitInt)
-		for i := 0; i < limitInt; i++ {
-			keys[i] = fmt.Sprintf("goods:%d", offsetInt+i)
-		}
-
-		ctx := context.Background()
-		goodsList := make([]entity.GoodsForList, 0)
-
-		for _, key := range keys {
-			result, err := redisClient.Get(ctx, key).Result()
-			if err == redis.Nil {
-				parts := strings.Split(key, ":")
-				if len(parts) != 2 {
-					log.Error("incorrect format of the redis key")
-					continue
-				}
-				keyInt, err := strconv.Atoi(parts[1])
-				if err != nil {
-					log.Error("incorrect good id: ", err)
-					continue
-				}
-				good, err := goods.GetGoodByID(keyInt)
-				if err != nil {
-					log.Error("error fetching good by ID: "+key, err)
-					continue
-				}
-				jsonData, _ := json.Marshal(good)
-				redisClient.Set(ctx, key, jsonData, time.Minute)
-				goodsList = append(goodsList, good)
-			} else if err != nil {
-				log.Error("error fetching from Redis: ", err)
-				continue
-			} else {
-				var good entity.GoodsForList
-				_ = json.Unmarshal([]byte(result), &good)
-				goodsList = append(goodsList, good)
+			offsetInt = 0
+			log.Info("offset is set to 0")
+		} else if offsetInt, err = strconv.Atoi(offset); err != nil || offsetInt < 0 {
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "offset"))
+			return
+		}
+
+		// v2 lists the goods of the project in the path
+		projectId := chi.URLParam(r, "projectId")
+		if projectId == "" {
+			projectId = r.URL.Query().Get("projectId")
+		}
+		if projectId != "" {
+			if projectIdInt, err = strconv.Atoi(projectId); err != nil {
+				resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
+				return
 			}
 		}
 
-		if len(goodsList) == 0 {
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode([]interface{}{})
+		filter, removedFilter, err := parseRemovedFilter(r.URL.Query().Get("removed"))
+		if err != nil {
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "removed"))
 			return
 		}
 
-		total, removed, err := goods.CalculateTotalAndRemoved()
+		labelsFilter := parseFilter(r.URL.Query())
+		labelsKey := filterKey(labelsFilter)
+		if labelsKey != "" {
+			filter += ":" + labelsKey
+		}
+
+		ctx := r.Context()
+
+		generation, err := cache.Generation(ctx, goodsCache, projectIdInt)
+		if err != nil {
+			log.Warn("error fetching cache generation", sl.Err(err))
+		}
+
+		// a built rank index answers ordered pages of a project in two round trips,
+		// it is skipped while the cache is unavailable and for pages filtered by labels
+		if index != nil && projectIdInt != 0 && removedFilter == nil && labelsKey == "" && err == nil {
+			goodsList, err := listFromIndex(ctx, index, projectIdInt, generation, limitInt, offsetInt)
+			if err != nil {
+				log.Error("error fetching page from rank index", sl.Err(err))
+			}
+			if goodsList != nil {
+				writeList(w, r, log, goods, goodsCache, projectIdInt, generation, goodsList, limitInt, offsetInt)
+				return
+			}
+		}
+
+		pageKey := cache.PageKey(projectIdInt, generation, filter, limitInt, offsetInt)
+		page, err := loader.Fetch(ctx, pageKey, cache.PageTTL, func(ctx context.Context) ([]byte, error) {
+			ids, err := goods.FilterGoodIDs(projectIdInt, removedFilter, labelsFilter, limitInt, offsetInt)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(ids)
+		})
 		if err != nil {
-			log.Error("error : ", err)
+			log.Error("error fetching page", sl.Err(err))
+			resp.Fail(w, r, resp.ErrInternal)
+			return
 		}
 
-		response := entity.GoodsListResponse{
-			Meta: entity.MetaForList{
-				Total:   total,
-				Removed: removed,
-				Limit:   limitInt,
-				Offset:  offsetInt,
-			},
-			Goods: goodsList,
+		var ids []int
+		if err := json.Unmarshal(page, &ids); err != nil {
+			log.Error("error decoding page", sl.Err(err))
+			resp.Fail(w, r, resp.ErrInternal)
+			return
 		}
 
-		log.Info("list geted")
+		goodsList, err := loadGoods(ctx, log, goodsCache, goods, projectIdInt, generation, ids)
+		if err != nil {
+			log.Error("error fetching goods", sl.Err(err))
+			resp.Fail(w, r, resp.ErrInternal)
+			return
+		}
+
+		writeList(w, r, log, goods, goodsCache, projectIdInt, generation, goodsList, limitInt, offsetInt)
+	}
+}
+
+// Get returns a single good of a project, removed goods included
+func Get(log *slog.Logger, goods Goods, goodsCache cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goods.Get"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		projectIdInt, err := strconv.Atoi(chi.URLParam(r, "projectId"))
+		if err != nil {
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
+			return
+		}
+
+		idInt, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "id"))
+			return
+		}
+
+		ctx := r.Context()
+
+		generation, err := cache.Generation(ctx, goodsCache, projectIdInt)
+		if err != nil {
+			log.Warn("error fetching cache generation", sl.Err(err))
+		}
+
+		found, err := loadGoods(ctx, log, goodsCache, goods, projectIdInt, generation, []int{idInt})
+		if err != nil {
+			log.Error("error fetching good", sl.Err(err))
+			resp.Fail(w, r, resp.ErrInternal)
+			return
+		}
+
+		if len(found) == 0 || found[0].ProjectId != projectIdInt {
+			resp.Fail(w, r, resp.ErrGoodNotFound)
+			return
+		}
 
 		w.WriteHeader(http.StatusOK)
-		render.JSON(w, r, response)
+		render.JSON(w, r, found[0])
+	}
+}
+
+// goodLocation is the v2 URL of a good
+func goodLocation(projectId, id int) string {
+	return fmt.Sprintf("/v2/projects/%d/goods/%d", projectId, id)
+}
+
+// loadGoods returns the goods of a page in the order of ids. Cached goods are read with one MGET,
+// all misses are loaded with a single query and written back in one batch.
+func loadGoods(ctx context.Context, log *slog.Logger, goodsCache cache.Cache, goods Goods, projectId int, generation int64, ids []int) ([]entity.GoodsForList, error) {
+	const op = "handlers.goods.loadGoods"
+
+	if len(ids) == 0 {
+		return []entity.GoodsForList{}, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = cache.GoodKey(projectId, generation, id)
+	}
+
+	found := make(map[int]entity.GoodsForList, len(ids))
+
+	cached, err := goodsCache.MGet(ctx, keys...)
+	if err != nil {
+		// the cache being down is not fatal, every good is loaded from Postgres instead
+		log.Warn("error fetching from cache", sl.Err(err))
+		cached = make([][]byte, len(ids))
+	}
+
+	misses := make([]int, 0, len(ids))
+	for i, data := range cached {
+		if data == nil {
+			misses = append(misses, ids[i])
+			continue
+		}
+
+		var good entity.GoodsForList
+		if err := json.Unmarshal(data, &good); err != nil {
+			misses = append(misses, ids[i])
+			continue
+		}
+		found[ids[i]] = good
+	}
+
+	if len(misses) > 0 {
+		loaded, err := goods.GetGoodsByIDs(misses)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		items := make(map[string][]byte, len(loaded))
+		for _, good := range loaded {
+			found[good.Id] = good
+
+			jsonData, _ := json.Marshal(good)
+			items[cache.GoodKey(projectId, generation, good.Id)] = jsonData
+		}
+		if err := goodsCache.MSet(ctx, items, cache.GoodTTL); err != nil {
+			log.Warn("error writing goods to cache", sl.Err(err))
+		}
+	}
+
+	goodsList := make([]entity.GoodsForList, 0, len(ids))
+	for _, id := range ids {
+		if good, ok := found[id]; ok {
+			goodsList = append(goodsList, good)
+		}
+	}
+
+	return goodsList, nil
+}
+
+// listFromIndex returns a page from the rank index, or nil if the index of the project is not built yet
+// or has not applied the events of every write up to the generation
+func listFromIndex(ctx context.Context, index *cache.RankIndex, projectId int, generation int64, limit, offset int) ([]entity.GoodsForList, error) {
+	ready, err := index.Ready(ctx, projectId, generation)
+	if err != nil || !ready {
+		return nil, err
 	}
+
+	return index.Page(ctx, projectId, limit, offset)
+}
+
+func writeList(w http.ResponseWriter, r *http.Request, log *slog.Logger, goods Goods, goodsCache cache.Cache, projectId int, generation int64, goodsList []entity.GoodsForList, limit, offset int) {
+	if len(goodsList) == 0 {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode([]interface{}{})
+		return
+	}
+
+	stats, err := projectStats(r.Context(), log, goodsCache, goods, projectId, generation)
+	if err != nil {
+		log.Error("error", sl.Err(err))
+	}
+
+	response := entity.GoodsListResponse{
+		Meta: entity.MetaForList{
+			Total:   stats.Total,
+			Active:  stats.Active,
+			Removed: stats.Removed,
+			Limit:   limit,
+			Offset:  offset,
+		},
+		Goods: goodsList,
+	}
+
+	log.Info("list geted")
+
+	w.WriteHeader(http.StatusOK)
+	render.JSON(w, r, response)
 }
 
-func Reprioritize(log *slog.Logger, goods Goods, redisClient *redis.Client, natsConn *nats.Conn) http.HandlerFunc {
+// projectStats returns the counters of a list scope, they are cached per generation,
+// so every write to the project moves readers to fresh counters
+func projectStats(ctx context.Context, log *slog.Logger, goodsCache cache.Cache, goods Goods, projectId int, generation int64) (entity.ProjectStats, error) {
+	const op = "handlers.goods.projectStats"
+
+	key := cache.StatsKey(projectId, generation)
+
+	data, err := goodsCache.Get(ctx, key)
+	if err == nil {
+		var stats entity.ProjectStats
+		if err := json.Unmarshal(data, &stats); err == nil {
+			return stats, nil
+		}
+	} else if !errors.Is(err, cache.ErrMiss) {
+		log.Warn("error fetching stats from cache", sl.Err(err))
+	}
+
+	stats, err := goods.ProjectStats(projectId)
+	if err != nil {
+		return stats, fmt.Errorf("%s: %w", op, err)
+	}
+
+	jsonData, _ := json.Marshal(stats)
+	if err := goodsCache.Set(ctx, key, jsonData, cache.PageTTL); err != nil {
+		log.Warn("error writing stats to cache", sl.Err(err))
+	}
+
+	return stats, nil
+}
+
+// parseRemovedFilter turns the removed query parameter into the filter name used in cache keys
+// and the value passed to the storage, nil matches both removed and active goods
+func parseRemovedFilter(value string) (string, *bool, error) {
+	if value == "" {
+		return "all", nil, nil
+	}
+
+	removed, err := strconv.ParseBool(value)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if removed {
+		return "removed", &removed, nil
+	}
+
+	return "active", &removed, nil
+}
+
+func Reprioritize(log *slog.Logger, goods Goods, goodsCache cache.Cache, natsConn *nats.Conn) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goods.Reprioritize"
 
@@ -437,86 +622,72 @@ func Reprioritize(log *slog.Logger, goods Goods, redisClient *redis.Client, nats
 		projectId := chi.URLParam(r, "projectId")
 		if projectId == "" {
 			log.Info("project id is empty")
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, resp.Error("project id parameter is required"))
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
 			return
 		}
 
 		id := chi.URLParam(r, "id")
 		if projectId == "" {
 			log.Info("id is empty")
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, resp.Error("id parameter is required"))
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "id"))
 			return
 		}
 
 		projectIdInt, err := strconv.Atoi(projectId)
 		if err != nil {
-			http.Error(w, "Invalid project ID", http.StatusBadRequest)
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
 			return
 		}
 
 		idInt, err := strconv.Atoi(id)
 		if err != nil {
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "id"))
 			return
 		}
 
 		var req entity.ReprioritizeRequest
 
-		err = render.DecodeJSON(r.Body, &req)
-		if errors.Is(err, io.EOF) {
-			log.Error("request body is empty")
-
-			render.JSON(w, r, resp.Error("empty request"))
-
+		if err := validate.DecodeJSON(r.Body, &req); err != nil {
+			log.Info("invalid request body", sl.Err(err))
+			resp.Fail(w, r, err)
 			return
 		}
-		if err != nil {
-			log.Error("failed to decode request body: ", err)
 
-			render.JSON(w, r, resp.Error("failed to decode request"))
+		log.Info("request body decoded", slog.Any("request", req))
 
+		name, description, labels, err := goods.Reprioritize(idInt, projectIdInt, req.NewPriority)
+		if err != nil {
+			if errors.Is(err, postgres.ErrReprioritizeQuotaExceeded) {
+				// the quota is counted per calendar minute
+				retryAfter := time.Until(time.Now().Truncate(time.Minute).Add(time.Minute))
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			}
+			failStorage(w, r, log, "Error updating priorities", err)
 			return
 		}
 
-		log.Info("request body decoded", slog.Any("request", req))
+		log.Info("good reprioritized")
 
-		name, description, err := goods.Reprioritize(idInt, projectIdInt, req.NewPriority)
+		generation, err := InvalidateRedisCache(goodsCache, natsConn, projectIdInt)
 		if err != nil {
-			if err == postgres.ErrNotFound {
-				w.WriteHeader(http.StatusNotFound)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"code":    3,
-					"message": "errors.good.notFound",
-					"details": map[string]string{},
-				})
-				return
-			}
-			log.Error("Error updating priorities: ", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
+			log.Error("Redis cache invalidation error", sl.Err(err))
 		}
 
 		event := &entity.GoodEvent{
+			Type:        "reprioritized",
 			Id:          idInt,
 			ProjectId:   projectIdInt,
+			Generation:  generation,
 			Name:        name,
 			Description: description,
 			Priority:    req.NewPriority,
-			Removed:     true,
+			Removed:     false,
 			EventTime:   time.Now(),
+			GoodLabels:  labels,
 		}
 
-		eventData, err := json.Marshal(event)
-		if err != nil {
-			log.Error("Error marshaling message: ", err)
-			return
-		}
-
-		err = natsConn.Publish("goods.removed", eventData)
-		if err != nil {
-			log.Error("Error sending message to NATS: ", err)
+		if err := natss.PublishEvent(natsConn, event); err != nil {
+			log.Error("Error sending message to NATS", sl.Err(err))
 			return
 		}
 
@@ -529,24 +700,165 @@ func Reprioritize(log *slog.Logger, goods Goods, redisClient *redis.Client, nats
 
 		w.WriteHeader(http.StatusOK)
 		render.JSON(w, r, response)
+	}
+}
+
+// Move moves a good to another project, it is put last in the priority order of that project
+func Move(log *slog.Logger, goods Goods, goodsCache cache.Cache, natsConn *nats.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goods.Move"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		projectIdInt, err := strconv.Atoi(chi.URLParam(r, "projectId"))
+		if err != nil {
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
+			return
+		}
 
-		err = InvalidateRedisCache(redisClient, idInt)
+		idInt, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			log.Error("Redis cache invalidation error: ", err)
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "id"))
+			return
+		}
+
+		var req entity.MoveRequest
+
+		if err := validate.DecodeJSON(r.Body, &req); err != nil {
+			log.Info("invalid request body", sl.Err(err))
+			resp.Fail(w, r, err)
+			return
+		}
+
+		if req.NewProjectId == projectIdInt {
+			resp.Fail(w, r, resp.ErrValidationFailed.WithFields(resp.FieldError{Field: "newProjectId", Rule: "changed"}))
+			return
+		}
+
+		response, err := goods.MoveGood(idInt, projectIdInt, req.NewProjectId)
+		if err != nil {
+			failStorage(w, r, log, "failed to move good", err)
+			return
+		}
+
+		log.Info("good moved")
+
+		generations := make(map[int]int64, 2)
+		for _, project := range []int{projectIdInt, req.NewProjectId} {
+			generation, err := InvalidateRedisCache(goodsCache, natsConn, project)
+			if err != nil {
+				log.Error("Redis cache invalidation error", sl.Err(err))
+			}
+			generations[project] = generation
 		}
 
-		log.Info("good deleted from REDIS")
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+
+		event := &entity.GoodEvent{
+			Type:               "moved",
+			Id:                 response.Id,
+			ProjectId:          response.ProjectId,
+			PreviousProjectId:  projectIdInt,
+			Generation:         generations[response.ProjectId],
+			PreviousGeneration: generations[projectIdInt],
+			Name:               response.Name,
+			Description:        response.Description,
+			Priority:           response.Priority,
+			Removed:            response.Removed,
+			EventTime:          time.Now(),
+			GoodLabels:         response.GoodLabels,
+		}
+
+		if err := natss.PublishEvent(natsConn, event); err != nil {
+			log.Error("Error sending message to NATS", sl.Err(err))
+			return
+		}
+
+		log.Info("message sended to NATS")
 	}
 }
 
-func InvalidateRedisCache(redisClient *redis.Client, goodID int) error {
+// StorageError maps storage errors to API errors, errors it does not know are internal
+func StorageError(err error) *resp.Error {
+	// callbacks run by the storage, such as patches, fail with API errors already
+	var apiErr *resp.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	switch {
+	case errors.Is(err, postgres.ErrNotFound):
+		return resp.ErrGoodNotFound.Wrap(err)
+	case errors.Is(err, postgres.ErrProjectNotFound):
+		return resp.ErrProjectNotFound.Wrap(err)
+	case errors.Is(err, postgres.ErrGoodsQuotaExceeded):
+		return resp.ErrGoodsQuotaExceeded.Wrap(err)
+	case errors.Is(err, postgres.ErrReprioritizeQuotaExceeded):
+		return resp.ErrReprioritizeQuotaExceeded.Wrap(err)
+	case errors.Is(err, postgres.ErrRefFailed):
+		return resp.ErrValidationFailed.Wrap(err).WithFields(resp.FieldError{Field: "ref", Rule: "ref"})
+	}
+
+	var rangeErr *postgres.PriorityRangeError
+	if errors.As(err, &rangeErr) {
+		return resp.ErrValidationFailed.Wrap(err).WithFields(resp.FieldError{
+			Field: "newPriority",
+			Rule:  "max",
+			Param: strconv.Itoa(rangeErr.Max),
+		})
+	}
+
+	return resp.ErrInternal.Wrap(err)
+}
+
+// failStorage answers with the API error of a storage error, unexpected errors are logged with msg
+func failStorage(w http.ResponseWriter, r *http.Request, log *slog.Logger, msg string, err error) {
+	apiErr := StorageError(err)
+	if errors.Is(apiErr, resp.ErrInternal) {
+		log.Error(msg, sl.Err(err))
+	}
+
+	resp.Fail(w, r, apiErr)
+}
+
+// Written invalidates the cache of the project of a changed good and publishes its event,
+// the gRPC and GraphQL APIs call it after every successful write
+func Written(log *slog.Logger, goodsCache cache.Cache, natsConn *nats.Conn, event *entity.GoodEvent) {
+	generation, err := InvalidateRedisCache(goodsCache, natsConn, event.ProjectId)
+	if err != nil {
+		log.Error("Redis cache invalidation error", sl.Err(err))
+	}
+	event.Generation = generation
+
+	if err := natss.PublishEvent(natsConn, event); err != nil {
+		log.Error("Error sending message to NATS", sl.Err(err))
+	}
+}
+
+// InvalidateRedisCache drops every cached list page and good of a project,
+// reprioritizing shifts neighbours too, so invalidating just the edited good is not enough.
+// Other instances are told over NATS to evict the project from their local cache tier.
+// It returns the new generation of the project, the event of the write carries it.
+func InvalidateRedisCache(goodsCache cache.Cache, natsConn *nats.Conn, projectID int) (int64, error) {
 	const op = "handlers.goods.InvalidateRedisCache"
 
 	ctx := context.Background()
-	key := fmt.Sprintf("goods:%d", goodID)
-	_, err := redisClient.Del(ctx, key).Result()
+	generation, err := cache.BumpGeneration(ctx, goodsCache, projectID)
 	if err != nil {
-		return fmt.Errorf("failed to invalidate redis cache for good ID %s:%d: %w", op, goodID, err)
+		return generation, fmt.Errorf("failed to invalidate redis cache for project ID %s:%d: %w", op, projectID, err)
+	}
+
+	if natsConn == nil {
+		return generation, nil
+	}
+
+	if err := natss.PublishInvalidation(natsConn, projectID); err != nil {
+		return generation, fmt.Errorf("failed to publish cache invalidation for project ID %s:%d: %w", op, projectID, err)
 	}
-	return nil
+
+	return generation, nil
 }
@@ -0,0 +1,113 @@
+package goods
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hezzl_test/internal/entity"
+	resp "hezzl_test/internal/lib/api/response"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxTags           = 20
+	maxTagLength      = 50
+	maxAttributesSize = 4096
+	attributePrefix   = "attr."
+)
+
+// CheckLabels normalizes the tags, trimmed, lower-cased, unique and sorted, and returns the rules
+// the labels fail, fields are named after prefix. Nil tags or attributes are left nil.
+func CheckLabels(labels *entity.GoodLabels, prefix string) []resp.FieldError {
+	var failed []resp.FieldError
+
+	if labels.Tags != nil {
+		tags := make([]string, 0, len(labels.Tags))
+		seen := make(map[string]bool, len(labels.Tags))
+
+		for i, tag := range labels.Tags {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			field := fmt.Sprintf("%stags.%d", prefix, i)
+
+			switch {
+			case tag == "":
+				failed = append(failed, resp.FieldError{Field: field, Rule: "required"})
+			case utf8.RuneCountInString(tag) > maxTagLength:
+				failed = append(failed, resp.FieldError{Field: field, Rule: "maxlen", Param: strconv.Itoa(maxTagLength)})
+			case !seen[tag]:
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+
+		if len(tags) > maxTags {
+			failed = append(failed, resp.FieldError{Field: prefix + "tags", Rule: "maxitems", Param: strconv.Itoa(maxTags)})
+		}
+
+		sort.Strings(tags)
+		labels.Tags = tags
+	}
+
+	if labels.Attributes != nil {
+		for key := range labels.Attributes {
+			if strings.TrimSpace(key) == "" {
+				failed = append(failed, resp.FieldError{Field: prefix + "attributes", Rule: "required"})
+				break
+			}
+		}
+
+		if document, err := json.Marshal(labels.Attributes); err != nil || len(document) > maxAttributesSize {
+			failed = append(failed, resp.FieldError{Field: prefix + "attributes", Rule: "maxsize", Param: strconv.Itoa(maxAttributesSize)})
+		}
+	}
+
+	return failed
+}
+
+// parseFilter reads the list filter from the query, every tag= has to be on the good
+// and every attr.<key>=<value> has to be among its attributes
+func parseFilter(query url.Values) entity.GoodsFilter {
+	var filter entity.GoodsFilter
+
+	labels := entity.GoodLabels{Tags: []string{}}
+	for _, tag := range query["tag"] {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			labels.Tags = append(labels.Tags, tag)
+		}
+	}
+	CheckLabels(&labels, "")
+	if len(labels.Tags) > 0 {
+		filter.Tags = labels.Tags
+	}
+
+	for param, values := range query {
+		key, ok := strings.CutPrefix(param, attributePrefix)
+		if !ok || key == "" || len(values) == 0 {
+			continue
+		}
+		if filter.Attributes == nil {
+			filter.Attributes = make(map[string]string)
+		}
+		filter.Attributes[key] = values[len(values)-1]
+	}
+
+	return filter
+}
+
+// filterKey is the part of a page cache key that tells filters apart, empty without a filter
+func filterKey(filter entity.GoodsFilter) string {
+	if len(filter.Tags) == 0 && len(filter.Attributes) == 0 {
+		return ""
+	}
+
+	// encoding/json sorts map keys, equal filters hash the same
+	canonical, _ := json.Marshal(filter)
+	sum := sha256.Sum256(canonical)
+
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,221 @@
+package goods
+
+import (
+	"bytes"
+	"encoding/json"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/go-chi/render"
+	"github.com/nats-io/nats.go"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/entity"
+	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/lib/logger/sl"
+	"hezzl_test/internal/lib/validate"
+	natss "hezzl_test/internal/nats"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// Update takes a patch instead of the whole good when the body has one of these media types
+const (
+	mergePatchType = "application/merge-patch+json" // RFC 7396
+	jsonPatchType  = "application/json-patch+json"  // RFC 6902
+)
+
+// patchFormat returns the patch media type of the request body, empty for a plain JSON update
+func patchFormat(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	switch mediaType {
+	case mergePatchType, jsonPatchType:
+		return mediaType
+	}
+
+	return ""
+}
+
+// patchGood applies a JSON Merge Patch or a JSON Patch to a good. Only the fields the patch changes
+// are written, the patched event carries only them and a patch that changes nothing publishes no event.
+func patchGood(w http.ResponseWriter, r *http.Request, log *slog.Logger, goods Goods, goodsCache cache.Cache, natsConn *nats.Conn, format string, id, projectId int) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Info("failed to read request body", sl.Err(err))
+		resp.Fail(w, r, resp.ErrMalformedBody.Wrap(err))
+		return
+	}
+
+	patch, err := decodePatch(format, body)
+	if err != nil {
+		log.Info("invalid patch", sl.Err(err))
+		resp.Fail(w, r, err)
+		return
+	}
+
+	before, after, err := goods.PatchGood(id, projectId, applyPatch(patch))
+	if err != nil {
+		failStorage(w, r, log, "failed to patch good", err)
+		return
+	}
+
+	changed := changes(before, after)
+
+	log.Info("good patched", slog.Int("changed", len(changed)))
+
+	var generation int64
+	if len(changed) > 0 {
+		if generation, err = InvalidateRedisCache(goodsCache, natsConn, projectId); err != nil {
+			log.Error("Redis cache invalidation error", sl.Err(err))
+		}
+	}
+
+	response := entity.GoodUpdateResponse{
+		Id:         after.Id,
+		ProjectId:  after.ProjectId,
+		Name:       *after.Name,
+		Priority:   after.Priority,
+		Removed:    after.Removed,
+		CreatedAt:  after.CreatedAt,
+		GoodLabels: after.GoodLabels,
+	}
+	if after.Description != nil {
+		response.Description = *after.Description
+	}
+
+	w.WriteHeader(http.StatusOK)
+	render.JSON(w, r, response)
+
+	if len(changed) == 0 {
+		return
+	}
+
+	event := &entity.GoodEvent{
+		Type:       entity.PatchedEvent,
+		Id:         response.Id,
+		ProjectId:  response.ProjectId,
+		EventTime:  time.Now(),
+		Generation: generation,
+		Changes:    changed,
+	}
+
+	if err := natss.PublishEvent(natsConn, event); err != nil {
+		log.Error("Error sending message to NATS", sl.Err(err))
+		return
+	}
+
+	log.Info("message sended to NATS")
+}
+
+// decodePatch checks the body is a patch of the format and returns a function applying it to a JSON document
+func decodePatch(format string, body []byte) (func([]byte) ([]byte, error), error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, resp.ErrEmptyBody
+	}
+	if !json.Valid(body) {
+		return nil, resp.ErrMalformedBody
+	}
+
+	if format == mergePatchType {
+		// RFC 7396 allows any value, but anything other than an object would replace the whole good
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, resp.ErrValidationFailed.Wrap(err).With("in", "body").With("reason", "a merge patch must be an object")
+		}
+
+		return func(doc []byte) ([]byte, error) {
+			return jsonpatch.MergePatch(doc, body)
+		}, nil
+	}
+
+	patch, err := jsonpatch.DecodePatch(body)
+	if err != nil {
+		return nil, resp.ErrValidationFailed.Wrap(err).With("in", "body").With("reason", "a JSON patch must be an array of operations")
+	}
+
+	return patch.Apply, nil
+}
+
+// applyPatch returns the storage callback that patches the current good, the result is validated like
+// a request body and every field other than name, description and the labels has to stay as it is
+func applyPatch(patch func([]byte) ([]byte, error)) func(entity.GoodDocument) (entity.GoodDocument, error) {
+	return func(current entity.GoodDocument) (entity.GoodDocument, error) {
+		var patched entity.GoodDocument
+
+		doc, err := json.Marshal(current)
+		if err != nil {
+			return patched, err
+		}
+
+		doc, err = patch(doc)
+		if err != nil {
+			// a failed test operation or a path that does not exist in the good
+			return patched, resp.ErrPatchFailed.Wrap(err).With("reason", err.Error())
+		}
+
+		if err := validate.DecodeJSON(bytes.NewReader(doc), &patched); err != nil {
+			return patched, err
+		}
+
+		// removed or null labels are cleared rather than kept
+		if patched.Tags == nil {
+			patched.Tags = []string{}
+		}
+		if patched.Attributes == nil {
+			patched.Attributes = map[string]any{}
+		}
+		if failed := CheckLabels(&patched.GoodLabels, ""); len(failed) > 0 {
+			return patched, resp.ErrValidationFailed.WithFields(failed...)
+		}
+
+		var readonly []resp.FieldError
+		for _, field := range []struct {
+			name string
+			same bool
+		}{
+			{"id", patched.Id == current.Id},
+			{"projectId", patched.ProjectId == current.ProjectId},
+			{"priority", patched.Priority == current.Priority},
+			{"removed", patched.Removed == current.Removed},
+			{"createdAt", patched.CreatedAt.Equal(current.CreatedAt)},
+		} {
+			if !field.same {
+				readonly = append(readonly, resp.FieldError{Field: field.name, Rule: "readonly"})
+			}
+		}
+		if len(readonly) > 0 {
+			return patched, resp.ErrValidationFailed.WithFields(readonly...)
+		}
+
+		return patched, nil
+	}
+}
+
+// changes returns the fields a patch changed with their new values, a cleared description is nil
+func changes(before, after entity.GoodDocument) map[string]any {
+	changed := make(map[string]any)
+
+	if *before.Name != *after.Name {
+		changed["name"] = *after.Name
+	}
+
+	switch {
+	case before.Description == nil && after.Description == nil:
+	case before.Description == nil || after.Description == nil || *before.Description != *after.Description:
+		changed["description"] = after.Description
+	}
+
+	if !reflect.DeepEqual(before.Tags, after.Tags) {
+		changed["tags"] = after.Tags
+	}
+	if !reflect.DeepEqual(before.Attributes, after.Attributes) {
+		changed["attributes"] = after.Attributes
+	}
+
+	return changed
+}
@@ -0,0 +1,109 @@
+package goods
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"hezzl_test/internal/entity"
+	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/lib/logger/sl"
+	"hezzl_test/internal/storage/postgres"
+	"html"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxSearchLimit = 100
+	maxQueryLength = 255
+)
+
+type Searcher interface {
+	SearchGoods(projectId int, query string, limit, offset int) ([]entity.GoodSearchResult, error)
+}
+
+// highlighter turns the markers of the storage into <mark> tags once the text around them is escaped
+var highlighter = strings.NewReplacer(postgres.HighlightStart, "<mark>", postgres.HighlightStop, "</mark>")
+
+// Search returns active goods matching a full-text query, best matches first, with the matched words highlighted
+func Search(log *slog.Logger, searcher Searcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goods.Search"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" || utf8.RuneCountInString(query) > maxQueryLength {
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "q"))
+			return
+		}
+
+		var (
+			limitInt     = 10
+			offsetInt    int
+			projectIdInt int
+			err          error
+		)
+
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			if limitInt, err = strconv.Atoi(limit); err != nil || limitInt <= 0 || limitInt > maxSearchLimit {
+				resp.Fail(w, r, resp.ErrValidationFailed.With("param", "limit"))
+				return
+			}
+		}
+
+		if offset := r.URL.Query().Get("offset"); offset != "" {
+			if offsetInt, err = strconv.Atoi(offset); err != nil || offsetInt < 0 {
+				resp.Fail(w, r, resp.ErrValidationFailed.With("param", "offset"))
+				return
+			}
+		}
+
+		// v2 searches the project in the path
+		projectId := chi.URLParam(r, "projectId")
+		if projectId == "" {
+			projectId = r.URL.Query().Get("projectId")
+		}
+		if projectId != "" {
+			if projectIdInt, err = strconv.Atoi(projectId); err != nil {
+				resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
+				return
+			}
+		}
+
+		results, err := searcher.SearchGoods(projectIdInt, query, limitInt, offsetInt)
+		if err != nil {
+			log.Error("error searching goods", sl.Err(err))
+			resp.Fail(w, r, resp.ErrInternal)
+			return
+		}
+
+		for i := range results {
+			results[i].Highlight.Name = highlight(results[i].Highlight.Name)
+			results[i].Highlight.Description = highlight(results[i].Highlight.Description)
+		}
+
+		log.Info("goods searched", slog.Int("found", len(results)))
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, entity.GoodsSearchResponse{
+			Meta: entity.MetaForSearch{
+				Query:  query,
+				Limit:  limitInt,
+				Offset: offsetInt,
+			},
+			Goods: results,
+		})
+	}
+}
+
+// highlight escapes user text, so only the <mark> tags of matches are markup
+func highlight(text string) string {
+	return highlighter.Replace(html.EscapeString(text))
+}
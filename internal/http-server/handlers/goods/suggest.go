@@ -0,0 +1,118 @@
+package goods
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/entity"
+	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/lib/logger/sl"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 20
+	maxPrefixLength     = 100
+)
+
+type Suggester interface {
+	SuggestGoods(projectId int, prefix string, limit int) ([]entity.GoodSuggestion, error)
+}
+
+// Suggest returns goods whose names match a typed prefix, in priority order. Answers are cached
+// for a short time per prefix, writes to the project move readers to fresh ones.
+func Suggest(log *slog.Logger, suggester Suggester, goodsCache cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goods.Suggest"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		// matching ignores case, so differently typed prefixes share the cache
+		prefix := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("prefix")))
+		if prefix == "" || utf8.RuneCountInString(prefix) > maxPrefixLength {
+			resp.Fail(w, r, resp.ErrValidationFailed.With("param", "prefix"))
+			return
+		}
+
+		var (
+			limitInt     = defaultSuggestLimit
+			projectIdInt int
+			err          error
+		)
+
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			if limitInt, err = strconv.Atoi(limit); err != nil || limitInt <= 0 || limitInt > maxSuggestLimit {
+				resp.Fail(w, r, resp.ErrValidationFailed.With("param", "limit"))
+				return
+			}
+		}
+
+		// v2 suggests goods of the project in the path
+		projectId := chi.URLParam(r, "projectId")
+		if projectId == "" {
+			projectId = r.URL.Query().Get("projectId")
+		}
+		if projectId != "" {
+			if projectIdInt, err = strconv.Atoi(projectId); err != nil {
+				resp.Fail(w, r, resp.ErrValidationFailed.With("param", "projectId"))
+				return
+			}
+		}
+
+		found, err := suggestions(r.Context(), log, suggester, goodsCache, projectIdInt, prefix, limitInt)
+		if err != nil {
+			log.Error("error suggesting goods", sl.Err(err))
+			resp.Fail(w, r, resp.ErrInternal)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, found)
+	}
+}
+
+// suggestions reads the suggestions of a prefix from the cache, or from the storage when they are not cached
+// or the cache is unavailable
+func suggestions(ctx context.Context, log *slog.Logger, suggester Suggester, goodsCache cache.Cache, projectId int, prefix string, limit int) ([]entity.GoodSuggestion, error) {
+	generation, err := cache.Generation(ctx, goodsCache, projectId)
+	if err != nil {
+		log.Warn("error fetching cache generation", sl.Err(err))
+		return suggester.SuggestGoods(projectId, prefix, limit)
+	}
+
+	key := cache.SuggestKey(projectId, generation, limit, prefix)
+
+	data, err := goodsCache.Get(ctx, key)
+	if err == nil {
+		var cached []entity.GoodSuggestion
+		if err := json.Unmarshal(data, &cached); err == nil {
+			return cached, nil
+		}
+	} else if !errors.Is(err, cache.ErrMiss) {
+		log.Warn("error fetching suggestions from cache", sl.Err(err))
+	}
+
+	found, err := suggester.SuggestGoods(projectId, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, _ := json.Marshal(found)
+	if err := goodsCache.Set(ctx, key, jsonData, cache.SuggestTTL); err != nil {
+		log.Warn("error writing suggestions to cache", sl.Err(err))
+	}
+
+	return found, nil
+}
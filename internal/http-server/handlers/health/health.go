@@ -0,0 +1,42 @@
+package health
+
+import (
+	"context"
+	"github.com/go-chi/render"
+	"hezzl_test/internal/sink"
+	"net/http"
+)
+
+type SinksHealth interface {
+	Health(ctx context.Context) []sink.Health
+}
+
+type SinksResponse struct {
+	Status string        `json:"status"`
+	Sinks  []sink.Health `json:"sinks"`
+}
+
+// Sinks reports the state of every event sink, the status is 503 if any of them is not ok
+func Sinks(sinks SinksHealth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health := sinks.Health(r.Context())
+
+		response := SinksResponse{
+			Status: sink.StatusOK,
+			Sinks:  health,
+		}
+
+		for _, h := range health {
+			if h.Status != sink.StatusOK {
+				response.Status = h.Status
+				break
+			}
+		}
+
+		if response.Status != sink.StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		render.JSON(w, r, response)
+	}
+}
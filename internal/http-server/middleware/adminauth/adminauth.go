@@ -0,0 +1,26 @@
+package adminauth
+
+import (
+	"crypto/subtle"
+	resp "hezzl_test/internal/lib/api/response"
+	"net/http"
+	"strings"
+)
+
+// New lets through requests carrying the admin token as "Authorization: Bearer <token>".
+// An empty token disables the admin routes, every request to them is rejected.
+func New(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				resp.Fail(w, r, resp.ErrUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
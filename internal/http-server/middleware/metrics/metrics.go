@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"hezzl_test/internal/http-server/middleware/version"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// unversioned labels requests outside the versioned routes, unmatched the ones no route matched,
+// so paths clients make up do not become label values
+const (
+	unversioned = "none"
+	unmatched   = "unmatched"
+)
+
+type Metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// New registers the request metrics in reg
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by API version, route and status.",
+		}, []string{"version", "method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of HTTP requests by API version and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"version", "method", "route"}),
+	}
+
+	reg.MustRegister(m.requests, m.duration)
+
+	return m
+}
+
+// Handler records every request once it is served. It runs on the router, the version is taken from
+// the response header the version middleware sets and the route from the pattern chi matched.
+func (m *Metrics) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+
+		apiVersion := ww.Header().Get(version.Header)
+		if apiVersion == "" {
+			apiVersion = unversioned
+		}
+
+		route := unmatched
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		m.requests.WithLabelValues(apiVersion, r.Method, route, strconv.Itoa(status)).Inc()
+		m.duration.WithLabelValues(apiVersion, r.Method, route).Observe(time.Since(start).Seconds())
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,276 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	resp "hezzl_test/internal/lib/api/response"
+	"hezzl_test/internal/lib/logger/sl"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limit allows Requests requests within any Window long period, a zero Requests disables it
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Route limits a single route per client, Pattern is the chi route pattern.
+// Routes with the same Name share their window, so one operation served under several versions has one limit.
+type Route struct {
+	Name    string
+	Method  string
+	Pattern string
+	Limit   Limit
+}
+
+// Options configures which sliding windows a request is counted in
+type Options struct {
+	ClientHeader string   // requests without a known key in it are identified by the remote address, gRPC calls carry it as metadata
+	ClientKeys   []string // the API keys of the clients, other values of ClientHeader are ignored
+	Client       Limit
+	Project      Limit
+	Routes       []Route
+}
+
+// slidingWindow checks every window first and only records the request once all of them have room,
+// so a rejected request does not use up any limit. Every window is a sorted set of request times,
+// a request costing more than one, a batch of operations, is recorded that many times.
+// Returns 1 or 0 and, per window, the remaining requests and the milliseconds until the oldest one leaves it.
+var slidingWindow = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local member = ARGV[1]
+local result = {1}
+
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[i * 3 - 1])
+	local window = tonumber(ARGV[i * 3])
+	local cost = tonumber(ARGV[i * 3 + 1])
+
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	local count = redis.call('ZCARD', key)
+
+	local reset = window
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	if oldest[2] then
+		reset = tonumber(oldest[2]) + window - now
+	end
+
+	if count + cost > limit then
+		result[1] = 0
+	end
+	table.insert(result, limit - count - cost)
+	table.insert(result, reset)
+end
+
+if result[1] == 1 then
+	for i, key in ipairs(KEYS) do
+		for n = 1, tonumber(ARGV[i * 3 + 1]) do
+			redis.call('ZADD', key, now, member .. ':' .. n)
+		end
+		redis.call('PEXPIRE', key, tonumber(ARGV[i * 3]))
+	end
+end
+
+return result
+`)
+
+type Limiter struct {
+	log  *slog.Logger
+	rdb  *redis.Client
+	opts Options
+	keys map[string]string // API key to the client id used in window keys
+}
+
+func New(log *slog.Logger, client *redis.Client, opts Options) *Limiter {
+	keys := make(map[string]string, len(opts.ClientKeys))
+	for _, key := range opts.ClientKeys {
+		if key == "" {
+			continue
+		}
+		// window keys carry a digest, the API keys themselves never get into Redis
+		sum := sha256.Sum256([]byte(key))
+		keys[key] = "key:" + hex.EncodeToString(sum[:8])
+	}
+
+	return &Limiter{
+		log:  log.With(slog.String("component", "middleware/ratelimit")),
+		rdb:  client,
+		opts: opts,
+		keys: keys,
+	}
+}
+
+type window struct {
+	key   string
+	limit Limit
+	cost  int // how many requests it is counted as
+}
+
+// Handler counts the request in the windows of its client, project and route. It has to run after
+// routing, in a chi Group or With, so the route pattern and the project id are known.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		projectId := chi.URLParam(r, "projectId")
+		if projectId == "" {
+			projectId = r.URL.Query().Get("projectId")
+		}
+
+		client := l.clientID(r.Header.Get(l.opts.ClientHeader), r.RemoteAddr)
+		windows := l.windows(client, projectId, r.Method, chi.RouteContext(r.Context()).RoutePattern())
+		if len(windows) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, limit, remaining, reset, err := l.take(r.Context(), windows)
+		if err != nil {
+			// Redis being down must not take the API down with it
+			l.log.Warn("rate limit check failed, request allowed", sl.Err(err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(reset)))
+			resp.Fail(w, r, resp.ErrRateLimited)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// Take counts a call that does not come over HTTP, a gRPC one, in the same windows as the HTTP requests.
+// key is the API key the client sent, addr its remote address, method and pattern are matched against the routes.
+// It reports whether the call is allowed and, when it is not, how long to wait before retrying.
+func (l *Limiter) Take(ctx context.Context, key, addr, projectId, method, pattern string) (bool, time.Duration, error) {
+	windows := l.windows(l.clientID(key, addr), projectId, method, pattern)
+	if len(windows) == 0 {
+		return true, 0, nil
+	}
+
+	allowed, _, _, reset, err := l.take(ctx, windows)
+
+	return allowed, reset, err
+}
+
+// TakeOperations counts operations sent together, the operations of a batch, in the windows of the routes
+// named after them as if every operation was a request of its own. counts maps a route name to the number
+// of operations, names without a configured route are not limited. The request itself is counted by Handler.
+func (l *Limiter) TakeOperations(r *http.Request, counts map[string]int) (bool, time.Duration, error) {
+	client := l.clientID(r.Header.Get(l.opts.ClientHeader), r.RemoteAddr)
+
+	var windows []window
+	for name, n := range counts {
+		for _, route := range l.opts.Routes {
+			// routes of one name share their window, so the first one is enough
+			if route.Name == name && route.Limit.Requests > 0 && n > 0 {
+				windows = append(windows, window{key: fmt.Sprintf("ratelimit:route:%s:%s", name, client), limit: route.Limit, cost: n})
+				break
+			}
+		}
+	}
+	if len(windows) == 0 {
+		return true, 0, nil
+	}
+
+	allowed, _, _, reset, err := l.take(r.Context(), windows)
+
+	return allowed, reset, err
+}
+
+func (l *Limiter) windows(client, projectId, method, pattern string) []window {
+	var windows []window
+
+	if l.opts.Client.Requests > 0 {
+		windows = append(windows, window{key: fmt.Sprintf("ratelimit:client:%s", client), limit: l.opts.Client, cost: 1})
+	}
+
+	if l.opts.Project.Requests > 0 && projectId != "" {
+		windows = append(windows, window{key: fmt.Sprintf("ratelimit:project:%s", projectId), limit: l.opts.Project, cost: 1})
+	}
+
+	for _, route := range l.opts.Routes {
+		if route.Limit.Requests > 0 && route.Pattern == pattern && (route.Method == "" || route.Method == method) {
+			name := route.Name
+			if name == "" {
+				name = method + " " + pattern
+			}
+			windows = append(windows, window{key: fmt.Sprintf("ratelimit:route:%s:%s", name, client), limit: route.Limit, cost: 1})
+		}
+	}
+
+	return windows
+}
+
+// clientID identifies the API client by its key. Only configured keys are trusted,
+// a made up key would otherwise get a fresh window with every request.
+func (l *Limiter) clientID(key, addr string) string {
+	if client, ok := l.keys[key]; ok {
+		return client
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
+
+// take records the request in every window if all of them have room and reports the window closest to its limit
+func (l *Limiter) take(ctx context.Context, windows []window) (bool, int, int, time.Duration, error) {
+	const op = "middleware.ratelimit.take"
+
+	keys := make([]string, len(windows))
+	args := []any{uuid.NewString()}
+	for i, window := range windows {
+		keys[i] = window.key
+		args = append(args, window.limit.Requests, window.limit.Window.Milliseconds(), window.cost)
+	}
+
+	result, err := slidingWindow.Run(ctx, l.rdb, keys, args...).Int64Slice()
+	if err != nil {
+		return false, 0, 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	allowed := result[0] == 1
+
+	limit, remaining, reset := 0, math.MaxInt, time.Duration(0)
+	for i, window := range windows {
+		left := int(result[1+i*2])
+		resetIn := time.Duration(result[2+i*2]) * time.Millisecond
+
+		if left < remaining || (left == remaining && resetIn > reset) {
+			limit, remaining, reset = window.limit.Requests, left, resetIn
+		}
+	}
+
+	// remaining is counted as if the request was let through
+	if !allowed || remaining < 0 {
+		remaining = 0
+	}
+
+	return allowed, limit, remaining, reset, nil
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,57 @@
+package version
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Header names the API version that served a response, the metrics middleware reads it back
+const Header = "API-Version"
+
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+// Version is a version of the API, a zero Deprecated means it is current
+type Version struct {
+	Name       string
+	Deprecated time.Time
+	Sunset     time.Time // announced to clients, the routes are not switched off by it
+	Successor  string    // link to the version that replaces this one
+}
+
+type ctxKey struct{}
+
+// New tags requests with the version and, once the version is deprecated, announces it with the
+// Deprecation, Sunset and Link headers of RFC 9745 and RFC 8594
+func New(v Version) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(Header, v.Name)
+
+			if !v.Deprecated.IsZero() {
+				w.Header().Set("Deprecation", fmt.Sprintf("@%d", v.Deprecated.Unix()))
+				if !v.Sunset.IsZero() {
+					w.Header().Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+				}
+				if v.Successor != "" {
+					w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", v.Successor))
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, v.Name)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// From returns the version a request was routed to, empty outside the versioned routes
+func From(ctx context.Context) string {
+	name, _ := ctx.Value(ctxKey{}).(string)
+
+	return name
+}
@@ -0,0 +1,124 @@
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+func init() {
+	// validation errors are sent to clients and logged, the schema and the value they refer to would only bloat them
+	openapi3.SchemaErrorDetailsDisabled = true
+
+	// JSON Patch bodies are decoded by kin-openapi already, merge patches are plain JSON too
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", openapi3filter.JSONBodyDecoder)
+}
+
+// Load parses and validates the embedded OpenAPI document
+func Load() (*openapi3.T, error) {
+	const op = "openapi.Load"
+
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return doc, nil
+}
+
+// Spec serves the document as JSON
+func Spec(doc *openapi3.T) (http.HandlerFunc, error) {
+	const op = "openapi.Spec"
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}, nil
+}
+
+const swaggerPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Goods API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: %q, dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+// SwaggerUI serves a Swagger UI page for the document at specURL
+func SwaggerUI(specURL string) http.HandlerFunc {
+	page := fmt.Sprintf(swaggerPage, specURL)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}
+}
+
+// CheckRoutes compares the routes of the router with the operations of the document and describes
+// every route that is only in one of them, an empty result means they match
+func CheckRoutes(doc *openapi3.T, router chi.Routes) ([]string, error) {
+	const op = "openapi.CheckRoutes"
+
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	served := make(map[string]bool)
+	err := chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		// chi patterns and OpenAPI paths share the {param} syntax, only the trailing slash of mounted routers differs
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+		served[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var drift []string
+	for route := range served {
+		if !documented[route] {
+			drift = append(drift, "not documented: "+route)
+		}
+	}
+	for route := range documented {
+		if !served[route] {
+			drift = append(drift, "not served: "+route)
+		}
+	}
+	sort.Strings(drift)
+
+	return drift, nil
+}
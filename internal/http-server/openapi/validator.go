@@ -0,0 +1,170 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-chi/chi/v5/middleware"
+	"hezzl_test/internal/lib/api/response"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Validator checks requests against the document before they reach the handlers and, if enabled,
+// checks responses too. Response mismatches are only logged, they mean the handlers drifted from the spec.
+type Validator struct {
+	log               *slog.Logger
+	router            routers.Router
+	validateResponses bool
+}
+
+func NewValidator(log *slog.Logger, doc *openapi3.T, validateResponses bool) (*Validator, error) {
+	const op = "openapi.NewValidator"
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Validator{
+		log:               log.With(slog.String("component", "middleware/openapi")),
+		router:            router,
+		validateResponses: validateResponses,
+	}, nil
+}
+
+func (v *Validator) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			// unknown routes and methods are answered by the router
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			response.Fail(w, r, requestError(err))
+			return
+		}
+
+		if !v.validateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		body := &bytes.Buffer{}
+		ww.Tee(body)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 status,
+			Header:                 ww.Header(),
+			Body:                   io.NopCloser(body),
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+		})
+		if err != nil {
+			v.log.Warn("response does not match the OpenAPI spec",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// requestError turns a validation error into an API error, the details name the part a client can act on
+func requestError(err error) *response.Error {
+	var requestErr *openapi3filter.RequestError
+	if errors.As(err, &requestErr) {
+		if requestErr.Parameter != nil {
+			return response.ErrValidationFailed.Wrap(err).
+				With("in", requestErr.Parameter.In).
+				With("name", requestErr.Parameter.Name)
+		}
+		if requestErr.RequestBody != nil {
+			var schemaErr *openapi3.SchemaError
+			var parseErr *openapi3filter.ParseError
+			switch {
+			case errors.As(err, &schemaErr):
+				if field, ok := schemaFieldError(schemaErr); ok {
+					return response.ErrValidationFailed.Wrap(err).WithFields(field)
+				}
+				return response.ErrValidationFailed.Wrap(err).With("in", "body").With("reason", schemaErr.Error())
+			case errors.Is(err, openapi3filter.ErrInvalidRequired):
+				return response.ErrEmptyBody.Wrap(err)
+			case errors.As(err, &parseErr):
+				return response.ErrMalformedBody.Wrap(err)
+			}
+			return response.ErrValidationFailed.Wrap(err).With("in", "body").With("reason", requestErr.Reason)
+		}
+	}
+
+	return response.ErrValidationFailed.Wrap(err)
+}
+
+// schemaFieldError reports a failed schema keyword as the field rule the handlers report for it,
+// so a request gets the same errors whether or not the validator is enabled
+func schemaFieldError(schemaErr *openapi3.SchemaError) (response.FieldError, bool) {
+	field := response.FieldError{Field: strings.Join(schemaErr.JSONPointer(), ".")}
+	schema := schemaErr.Schema
+
+	switch schemaErr.SchemaField {
+	case "required", "minLength", "minItems":
+		field.Rule = "required"
+	case "maxLength":
+		field.Rule, field.Param = "maxlen", strconv.FormatUint(*schema.MaxLength, 10)
+	case "maxItems":
+		field.Rule, field.Param = "maxitems", strconv.FormatUint(*schema.MaxItems, 10)
+	case "enum":
+		values := make([]string, len(schema.Enum))
+		for i, value := range schema.Enum {
+			values[i] = fmt.Sprint(value)
+		}
+		field.Rule, field.Param = "oneof", strings.Join(values, ", ")
+	case "minimum":
+		field.Rule, field.Param = "min", strconv.FormatFloat(*schema.Min, 'f', -1, 64)
+	case "maximum":
+		field.Rule, field.Param = "max", strconv.FormatFloat(*schema.Max, 'f', -1, 64)
+	case "type":
+		field.Rule, field.Param = "type", strings.Join(schema.Type.Slice(), ", ")
+	case "properties":
+		// the unsupported property is only named in the reason
+		name := strings.TrimSuffix(strings.TrimPrefix(schemaErr.Reason, "property "), " is unsupported")
+		if unquoted, err := strconv.Unquote(name); err == nil {
+			name = unquoted
+		}
+		field.Field, field.Rule = name, "unknown"
+	default:
+		return field, false
+	}
+
+	return field, true
+}
@@ -1,24 +1,247 @@
 package response
 
-type Response struct {
-	Status string `json:"status"`
-	Error  string `json:"error,omitempty"`
-}
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"net/http"
+	"strings"
+)
+
+// Code is a stable error code, clients branch on it rather than on messages
+type Code string
 
 const (
-	StatusOK    = "OK"
-	StatusError = "Error"
+	CodeEmptyBody                 Code = "empty_body"
+	CodeMalformedBody             Code = "malformed_body"
+	CodeValidationFailed          Code = "validation_failed"
+	CodeGoodNotFound              Code = "good_not_found"
+	CodeProjectNotFound           Code = "project_not_found"
+	CodeRouteNotFound             Code = "route_not_found"
+	CodeUnauthorized              Code = "unauthorized"
+	CodeMethodNotAllowed          Code = "method_not_allowed"
+	CodeGoodsQuotaExceeded        Code = "goods_quota_exceeded"
+	CodeReprioritizeQuotaExceeded Code = "reprioritize_quota_exceeded"
+	CodeRateLimited               Code = "rate_limited"
+	CodeWarmupRunning             Code = "warmup_running"
+	CodePatchFailed               Code = "patch_failed"
+	CodeUnavailable               Code = "unavailable"
+	CodeInternal                  Code = "internal"
 )
 
-func OK() Response {
-	return Response{
-		Status: StatusOK,
+// Error is an API error of the catalog. Details are sent to the client, the cause is only for logs.
+type Error struct {
+	Code    Code
+	Status  int
+	Details map[string]any
+	Fields  []FieldError
+
+	cause error
+}
+
+// FieldError is a validation rule a field of the request failed, param is the bound of the rule if it has one
+type FieldError struct {
+	Field string
+	Rule  string
+	Param string
+}
+
+// message holds the texts of a code per language
+type message struct {
+	en string
+	ru string
+}
+
+const defaultLanguage = "en"
+
+var (
+	ErrEmptyBody                 = define(CodeEmptyBody, http.StatusBadRequest, "Request body is empty", "Тело запроса пустое")
+	ErrMalformedBody             = define(CodeMalformedBody, http.StatusBadRequest, "Request body is not valid JSON", "Тело запроса не является корректным JSON")
+	ErrValidationFailed          = define(CodeValidationFailed, http.StatusUnprocessableEntity, "The request is invalid", "Запрос содержит ошибки")
+	ErrGoodNotFound              = define(CodeGoodNotFound, http.StatusNotFound, "Good not found", "Товар не найден")
+	ErrProjectNotFound           = define(CodeProjectNotFound, http.StatusNotFound, "Project not found", "Проект не найден")
+	ErrRouteNotFound             = define(CodeRouteNotFound, http.StatusNotFound, "Route not found", "Маршрут не найден")
+	ErrUnauthorized              = define(CodeUnauthorized, http.StatusUnauthorized, "The admin token is missing or invalid", "Токен администратора не передан или неверен")
+	ErrMethodNotAllowed          = define(CodeMethodNotAllowed, http.StatusMethodNotAllowed, "Method not allowed", "Метод не поддерживается")
+	ErrGoodsQuotaExceeded        = define(CodeGoodsQuotaExceeded, http.StatusConflict, "The project reached its goods quota", "Проект исчерпал квоту товаров")
+	ErrReprioritizeQuotaExceeded = define(CodeReprioritizeQuotaExceeded, http.StatusTooManyRequests, "Too many priority changes, retry later", "Слишком много изменений приоритета, повторите позже")
+	ErrRateLimited               = define(CodeRateLimited, http.StatusTooManyRequests, "Too many requests, retry later", "Слишком много запросов, повторите позже")
+	ErrWarmupRunning             = define(CodeWarmupRunning, http.StatusConflict, "A cache warm-up is already running", "Прогрев кэша уже выполняется")
+	ErrPatchFailed               = define(CodePatchFailed, http.StatusConflict, "The patch does not apply to the current good", "Патч не применяется к текущему состоянию товара")
+	ErrUnavailable               = define(CodeUnavailable, http.StatusServiceUnavailable, "The service is temporarily unavailable", "Сервис временно недоступен")
+	ErrInternal                  = define(CodeInternal, http.StatusInternalServerError, "Internal error", "Внутренняя ошибка")
+)
+
+var messages = make(map[Code]message)
+
+// ruleMessages are the texts of failed validation rules, %s is the param of the rule
+var ruleMessages = map[string]message{
+	"required":   {en: "must not be empty", ru: "не может быть пустым"},
+	"maxlen":     {en: "must be at most %s characters long", ru: "должно быть не длиннее %s символов"},
+	"min":        {en: "must be at least %s", ru: "должно быть не меньше %s"},
+	"max":        {en: "must be at most %s", ru: "должно быть не больше %s"},
+	"type":       {en: "must be of type %s", ru: "должно иметь тип %s"},
+	"unknown":    {en: "is not a known field", ru: "неизвестное поле"},
+	"changed":    {en: "must differ from the current value", ru: "должно отличаться от текущего значения"},
+	"readonly":   {en: "cannot be changed", ru: "не может быть изменено"},
+	"oneof":      {en: "must be one of %s", ru: "должно быть одним из %s"},
+	"maxitems":   {en: "must have at most %s items", ru: "должно содержать не больше %s элементов"},
+	"ref":        {en: "must be an earlier operation that succeeded", ru: "должно указывать на предыдущую успешную операцию"},
+	"complexity": {en: "must ask for at most %s items in total", ru: "должен запрашивать не больше %s элементов в сумме"},
+	"maxsize":    {en: "must be at most %s bytes as JSON", ru: "должно занимать не больше %s байт в JSON"},
+}
+
+func define(code Code, status int, en, ru string) *Error {
+	messages[code] = message{en: en, ru: ru}
+
+	return &Error{Code: code, Status: status}
+}
+
+// FieldMessage is a failed rule of a field in an error response
+type FieldMessage struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Code      Code           `json:"code"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestId string         `json:"requestId,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return string(e.Code) + ": " + e.cause.Error()
 	}
+
+	return string(e.Code)
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
 }
 
-func Error(msg string) Response {
-	return Response{
-		Status: StatusError,
-		Error:  msg,
+// Is matches errors by code, so errors with details still match the catalog entry
+func (e *Error) Is(target error) bool {
+	var t *Error
+	if !errors.As(target, &t) {
+		return false
 	}
+
+	return t.Code == e.Code
+}
+
+// With returns a copy of the error with a detail added
+func (e *Error) With(key string, value any) *Error {
+	c := *e
+	c.Details = make(map[string]any, len(e.Details)+1)
+	for k, v := range e.Details {
+		c.Details[k] = v
+	}
+	c.Details[key] = value
+
+	return &c
+}
+
+// WithFields returns a copy of the error with failed field rules, they are sent in details.fields
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	c := *e
+	c.Fields = append(append([]FieldError(nil), e.Fields...), fields...)
+
+	return &c
+}
+
+// Wrap returns a copy of the error caused by err
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.cause = err
+
+	return &c
+}
+
+// Message returns the text of the error in the language, English if there is no translation
+func (e *Error) Message(language string) string {
+	return messages[e.Code].in(language)
+}
+
+// DetailsIn returns the details with the failed field rules in the language
+func (e *Error) DetailsIn(language string) map[string]any {
+	if len(e.Fields) == 0 {
+		return e.Details
+	}
+
+	details := make(map[string]any, len(e.Details)+1)
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	details["fields"] = e.FieldMessages(language)
+
+	return details
+}
+
+// FieldMessages returns the failed field rules with their texts in the language
+func (e *Error) FieldMessages(language string) []FieldMessage {
+	fields := make([]FieldMessage, len(e.Fields))
+	for i, field := range e.Fields {
+		text := ruleMessages[field.Rule].in(language)
+		if strings.Contains(text, "%s") {
+			text = fmt.Sprintf(text, field.Param)
+		}
+		fields[i] = FieldMessage{Field: field.Field, Rule: field.Rule, Message: text}
+	}
+
+	return fields
+}
+
+func (m message) in(language string) string {
+	if language == "ru" && m.ru != "" {
+		return m.ru
+	}
+
+	return m.en
+}
+
+// Fail writes err in the common error shape, errors outside the catalog are sent as internal errors
+func Fail(w http.ResponseWriter, r *http.Request, err error) {
+	status, body := Body(r, err)
+	body.RequestId = middleware.GetReqID(r.Context())
+
+	w.WriteHeader(status)
+	render.JSON(w, r, body)
+}
+
+// Body returns the status and the body Fail answers err with, without the request id,
+// for errors that are a part of another response
+func Body(r *http.Request, err error) (int, ErrorResponse) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = ErrInternal
+	}
+
+	language := Language(r)
+
+	return apiErr.Status, ErrorResponse{
+		Code:    apiErr.Code,
+		Message: apiErr.Message(language),
+		Details: apiErr.DetailsIn(language),
+	}
+}
+
+// Language picks the message language from Accept-Language, the first supported one wins
+func Language(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+
+		switch primary {
+		case "ru", "en":
+			return primary
+		}
+	}
+
+	return defaultLanguage
 }
@@ -0,0 +1,17 @@
+package sl
+
+import (
+	"log/slog"
+)
+
+// Err wraps an error into a slog attribute
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.String("error", "")
+	}
+
+	return slog.Attr{
+		Key:   "error",
+		Value: slog.StringValue(err.Error()),
+	}
+}
@@ -0,0 +1,171 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	resp "hezzl_test/internal/lib/api/response"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rules are declared in validate tags of request fields and checked in the order they are listed:
+//
+//	trim      removes leading and trailing white space, the other rules see the trimmed value
+//	required  the value must not be empty or zero
+//	maxlen=N  a string must be at most N characters long
+//	min=N     a number must be at least N
+//	max=N     a number must be at most N
+//
+// Optional fields are pointers, a nil pointer fails required and skips the other rules.
+
+const unknownFieldPrefix = "json: unknown field "
+
+// DecodeJSON decodes a request body into the struct v points to and validates it.
+// Fields the struct does not have are rejected rather than ignored.
+func DecodeJSON(r io.Reader, v any) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return decodeError(err)
+	}
+
+	return Struct(v)
+}
+
+// Struct checks the rules of every field of the struct v points to, trim rules change the fields in place
+func Struct(v any) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: %T is not a pointer to a struct", v))
+	}
+	value = value.Elem()
+
+	var failed []resp.FieldError
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		if rule, param, ok := check(value.Field(i), tag); !ok {
+			failed = append(failed, resp.FieldError{Field: fieldName(field), Rule: rule, Param: param})
+		}
+	}
+
+	if len(failed) > 0 {
+		return resp.ErrValidationFailed.WithFields(failed...)
+	}
+
+	return nil
+}
+
+// check applies the rules of a tag to a field and returns the first rule it fails
+func check(value reflect.Value, tag string) (string, string, bool) {
+	for _, spec := range strings.Split(tag, ",") {
+		rule, param, _ := strings.Cut(spec, "=")
+
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				if rule == "required" {
+					return rule, param, false
+				}
+				continue
+			}
+			value = value.Elem()
+		}
+
+		switch rule {
+		case "trim":
+			value.SetString(strings.TrimSpace(value.String()))
+		case "required":
+			if value.IsZero() {
+				return rule, param, false
+			}
+		case "maxlen":
+			if utf8.RuneCountInString(value.String()) > bound(rule, param) {
+				return rule, param, false
+			}
+		case "min":
+			if value.Int() < int64(bound(rule, param)) {
+				return rule, param, false
+			}
+		case "max":
+			if value.Int() > int64(bound(rule, param)) {
+				return rule, param, false
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", rule))
+		}
+	}
+
+	return "", "", true
+}
+
+func bound(rule, param string) int {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		panic(fmt.Sprintf("validate: rule %s needs a number, got %q", rule, param))
+	}
+
+	return n
+}
+
+// fieldName is the name of a field in requests, the one of its json tag
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+
+	return name
+}
+
+// decodeError turns a decoding error into an API error, errors of single fields are reported as field errors
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return resp.ErrEmptyBody.Wrap(err)
+	case errors.As(err, &typeErr):
+		return resp.ErrValidationFailed.Wrap(err).WithFields(resp.FieldError{
+			Field: typeErr.Field,
+			Rule:  "type",
+			Param: jsonType(typeErr.Type),
+		})
+	case strings.HasPrefix(err.Error(), unknownFieldPrefix):
+		// encoding/json has no error type for unknown fields, only this message
+		field, unquoteErr := strconv.Unquote(strings.TrimPrefix(err.Error(), unknownFieldPrefix))
+		if unquoteErr != nil {
+			field = strings.TrimPrefix(err.Error(), unknownFieldPrefix)
+		}
+		return resp.ErrValidationFailed.Wrap(err).WithFields(resp.FieldError{Field: field, Rule: "unknown"})
+	}
+
+	return resp.ErrMalformedBody.Wrap(err)
+}
+
+// jsonType names a Go type the way JSON Schema does
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+
+	return "object"
+}
@@ -0,0 +1,121 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/lib/logger/sl"
+	"log/slog"
+	"sync"
+)
+
+const (
+	invalidationSubject         = "cache.invalidate.%d"
+	invalidationSubjectWildcard = "cache.invalidate.*"
+)
+
+// Invalidation tells other instances that the cache of a project is outdated.
+// Seq grows by one with every message of an origin, a gap means messages were missed.
+type Invalidation struct {
+	Origin    string `json:"origin"`
+	Seq       uint64 `json:"seq"`
+	ProjectId int    `json:"projectId"`
+}
+
+// LocalCache is the in-process cache tier evicted on invalidations
+type LocalCache interface {
+	DelFunc(match func(key string) bool) int
+	Flush()
+}
+
+var (
+	// origin identifies this instance, it changes on every start
+	origin = uuid.NewString()
+
+	publishMutex sync.Mutex
+	publishSeq   uint64
+)
+
+// PublishInvalidation broadcasts that the cache of a project changed
+func PublishInvalidation(natsConn *nats.Conn, projectId int) error {
+	const op = "internal.nats.PublishInvalidation"
+
+	// the sequence is assigned and published under one lock, so messages leave in sequence order
+	publishMutex.Lock()
+	defer publishMutex.Unlock()
+
+	publishSeq++
+
+	data, err := json.Marshal(Invalidation{
+		Origin:    origin,
+		Seq:       publishSeq,
+		ProjectId: projectId,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := natsConn.Publish(fmt.Sprintf(invalidationSubject, projectId), data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SubscribeToInvalidations evicts local cache entries of projects changed on other instances.
+// A gap in the sequence of an origin, or a reconnect to NATS, flushes the whole local cache,
+// since the missed invalidations are unknown.
+func SubscribeToInvalidations(log *slog.Logger, natsConn *nats.Conn, local LocalCache) error {
+	const op = "internal.nats.SubscribeToInvalidations"
+
+	log = log.With(slog.String("op", op))
+
+	var (
+		mu      sync.Mutex
+		lastSeq = make(map[string]uint64)
+	)
+
+	natsConn.SetReconnectHandler(func(*nats.Conn) {
+		local.Flush()
+		log.Warn("reconnected to NATS, local cache flushed")
+	})
+
+	_, err := natsConn.Subscribe(invalidationSubjectWildcard, func(m *nats.Msg) {
+		var inv Invalidation
+		if err := json.Unmarshal(m.Data, &inv); err != nil {
+			log.Error("failed to decode invalidation", slog.String("subject", m.Subject), sl.Err(err))
+			return
+		}
+
+		// writes of this instance already evicted the local tier
+		if inv.Origin == origin {
+			return
+		}
+
+		mu.Lock()
+		last, seen := lastSeq[inv.Origin]
+		lastSeq[inv.Origin] = inv.Seq
+		mu.Unlock()
+
+		if seen && inv.Seq != last+1 {
+			local.Flush()
+			log.Warn("missed cache invalidations, local cache flushed",
+				slog.String("origin", inv.Origin),
+				slog.Uint64("expected", last+1),
+				slog.Uint64("got", inv.Seq),
+			)
+			return
+		}
+
+		local.DelFunc(func(key string) bool {
+			return cache.IsProjectKey(key, inv.ProjectId)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("%s: subscribe %s: %w", op, invalidationSubjectWildcard, err)
+	}
+
+	return nil
+}
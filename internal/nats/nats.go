@@ -3,61 +3,96 @@ package nats
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 	"hezzl_test/internal/entity"
-	"hezzl_test/internal/storage/clickhouse"
+	"hezzl_test/internal/lib/logger/sl"
+	"log/slog"
+	"strings"
 )
 
-func SubscribeToNATSEvents(natsConn *nats.Conn, chDB driver.Conn) error {
+const goodsSubject = "goods.*"
+
+// EventPublisher receives every decoded goods event
+type EventPublisher interface {
+	Publish(event entity.GoodEvent)
+}
+
+// PublishEvent publishes a goods event on goods.<type>, an event without an id gets a new one.
+// Ids are UUIDv7, so events of the same second still sort in the order they were published.
+// The HTTP handlers, the gRPC server and the commands all publish through it.
+func PublishEvent(natsConn *nats.Conn, event *entity.GoodEvent) error {
+	const op = "internal.nats.PublishEvent"
+
+	if event.EventId == "" {
+		event.EventId = uuid.Must(uuid.NewV7()).String()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := natsConn.Publish("goods."+event.Type, data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func SubscribeToNATSEvents(log *slog.Logger, natsConn *nats.Conn, publisher EventPublisher) error {
 	const op = "internal.nats.SubscribeToNATSEvents"
 
-	go func() {
-		_, err := natsConn.Subscribe("goods.created", func(m *nats.Msg) {
-			var event entity.GoodEvent
-			if err := json.Unmarshal(m.Data, &event); err != nil {
-				fmt.Errorf("%s : %w", op, err)
-				return
-			}
+	log = log.With(slog.String("op", op))
 
-			clickhouse.BufferEvent(event)
-		})
-		if err != nil {
-			fmt.Errorf("%s : %w", op, err)
-			return
-		}
-	}()
-
-	go func() {
-		_, err := natsConn.Subscribe("goods.updated", func(m *nats.Msg) {
-			var event entity.GoodEvent
-			if err := json.Unmarshal(m.Data, &event); err != nil {
-				fmt.Errorf("%s : %w", op, err)
-				return
-			}
-
-			clickhouse.BufferEvent(event)
-		})
-		if err != nil {
-			fmt.Errorf("%s : %w", op, err)
-			return
-		}
-	}()
-
-	go func() {
-		_, err := natsConn.Subscribe("goods.removed", func(m *nats.Msg) {
-			var event entity.GoodEvent
-			if err := json.Unmarshal(m.Data, &event); err != nil {
-				fmt.Errorf("%s : %w", op, err)
-				return
-			}
-
-			clickhouse.BufferEvent(event)
-		})
+	_, err := natsConn.Subscribe(goodsSubject, func(m *nats.Msg) {
+		event, err := decodeEvent(m)
 		if err != nil {
-			fmt.Errorf("%s : %w", op, err)
+			log.Error("failed to decode event", slog.String("subject", m.Subject), sl.Err(err))
 			return
 		}
-	}()
+
+		publisher.Publish(event)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: subscribe %s: %w", op, goodsSubject, err)
+	}
+
 	return nil
 }
+
+// WatchEvents calls fn with every goods event until the returned subscription is unsubscribed,
+// messages are handled one at a time in the order they were received
+func WatchEvents(natsConn *nats.Conn, fn func(entity.GoodEvent)) (*nats.Subscription, error) {
+	const op = "internal.nats.WatchEvents"
+
+	sub, err := natsConn.Subscribe(goodsSubject, func(m *nats.Msg) {
+		if event, err := decodeEvent(m); err == nil {
+			fn(event)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: subscribe %s: %w", op, goodsSubject, err)
+	}
+
+	return sub, nil
+}
+
+func decodeEvent(m *nats.Msg) (entity.GoodEvent, error) {
+	var event entity.GoodEvent
+	if err := json.Unmarshal(m.Data, &event); err != nil {
+		return event, err
+	}
+
+	// events published before event ids were introduced get an id
+	// derived from the payload, so a redelivery maps to the same id
+	if event.EventId == "" {
+		event.EventId = uuid.NewSHA1(uuid.NameSpaceOID, m.Data).String()
+	}
+
+	if event.Type == "" {
+		event.Type = strings.TrimPrefix(m.Subject, "goods.")
+	}
+
+	return event, nil
+}
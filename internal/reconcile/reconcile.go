@@ -0,0 +1,152 @@
+package reconcile
+
+import (
+	"github.com/google/uuid"
+	"hezzl_test/internal/entity"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const (
+	// KindMissing means the good has no event in ClickHouse at all
+	KindMissing = "missing"
+	// KindStalePriority means the latest event carries another priority than the goods row
+	KindStalePriority = "stale_priority"
+	// KindWrongRemoved means the latest event disagrees with the goods row about removal
+	KindWrongRemoved = "wrong_removed"
+	// KindStaleFields means name, description, project or labels of the latest event are outdated
+	KindStaleFields = "stale_fields"
+	// KindOrphaned means ClickHouse has events of a good that is not in Postgres
+	KindOrphaned = "orphaned"
+
+	// EventType is the type of the synthetic events emitted to repair the log
+	EventType = "reconciled"
+)
+
+// Discrepancy describes a single difference between a goods row and its latest event
+type Discrepancy struct {
+	Kind      string            `json:"kind"`
+	GoodId    int               `json:"goodId"`
+	ProjectId int               `json:"projectId"`
+	Expected  *entity.GoodEvent `json:"expected,omitempty"` // state in Postgres
+	Actual    *entity.GoodEvent `json:"actual,omitempty"`   // latest event in ClickHouse
+}
+
+// Compare checks every good against its latest event. A good gets at most one discrepancy
+// per kind, the result is ordered by good id.
+func Compare(goods []entity.GoodsForList, latest map[int]entity.GoodEvent) []Discrepancy {
+	var discrepancies []Discrepancy
+
+	seen := make(map[int]struct{}, len(goods))
+
+	for _, good := range goods {
+		seen[good.Id] = struct{}{}
+
+		expected := stateOf(good)
+
+		actual, ok := latest[good.Id]
+		if !ok {
+			discrepancies = append(discrepancies, Discrepancy{
+				Kind:      KindMissing,
+				GoodId:    good.Id,
+				ProjectId: good.ProjectId,
+				Expected:  &expected,
+			})
+			continue
+		}
+
+		add := func(kind string) {
+			discrepancies = append(discrepancies, Discrepancy{
+				Kind:      kind,
+				GoodId:    good.Id,
+				ProjectId: good.ProjectId,
+				Expected:  &expected,
+				Actual:    &actual,
+			})
+		}
+
+		if actual.Priority != good.Priority {
+			add(KindStalePriority)
+		}
+		if actual.Removed != good.Removed {
+			add(KindWrongRemoved)
+		}
+		if actual.Name != good.Name || actual.Description != good.Description || actual.ProjectId != good.ProjectId ||
+			!sameLabels(actual.GoodLabels, good.GoodLabels) {
+			add(KindStaleFields)
+		}
+	}
+
+	for id, event := range latest {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+
+		event := event
+		discrepancies = append(discrepancies, Discrepancy{
+			Kind:      KindOrphaned,
+			GoodId:    id,
+			ProjectId: event.ProjectId,
+			Actual:    &event,
+		})
+	}
+
+	sort.SliceStable(discrepancies, func(i, j int) bool {
+		return discrepancies[i].GoodId < discrepancies[j].GoodId
+	})
+
+	return discrepancies
+}
+
+// Corrections builds one synthetic event per good that needs repair, carrying the current Postgres state.
+// Orphaned goods are skipped, there is no row to take the state from.
+func Corrections(discrepancies []Discrepancy) []entity.GoodEvent {
+	var events []entity.GoodEvent
+
+	corrected := make(map[int]struct{})
+	now := time.Now()
+
+	for _, d := range discrepancies {
+		if d.Expected == nil {
+			continue
+		}
+		if _, ok := corrected[d.GoodId]; ok {
+			continue
+		}
+		corrected[d.GoodId] = struct{}{}
+
+		event := *d.Expected
+		event.EventId = uuid.Must(uuid.NewV7()).String()
+		event.Type = EventType
+		event.EventTime = now
+
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func stateOf(good entity.GoodsForList) entity.GoodEvent {
+	return entity.GoodEvent{
+		Id:          good.Id,
+		ProjectId:   good.ProjectId,
+		Name:        good.Name,
+		Description: good.Description,
+		Priority:    good.Priority,
+		Removed:     good.Removed,
+		GoodLabels:  good.GoodLabels,
+	}
+}
+
+// sameLabels compares labels, nil and empty ones are the same
+func sameLabels(a, b entity.GoodLabels) bool {
+	if len(a.Tags) != len(b.Tags) || len(a.Attributes) != len(b.Attributes) {
+		return false
+	}
+	if len(a.Tags) > 0 && !reflect.DeepEqual(a.Tags, b.Tags) {
+		return false
+	}
+
+	return len(a.Attributes) == 0 || reflect.DeepEqual(a.Attributes, b.Attributes)
+}
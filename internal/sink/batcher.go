@@ -0,0 +1,250 @@
+package sink
+
+import (
+	"context"
+	"hezzl_test/internal/entity"
+	"hezzl_test/internal/lib/logger/sl"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+	StatusDown    = "down"
+)
+
+// Health is the state of a single sink
+type Health struct {
+	Name                string    `json:"name"`
+	Status              string    `json:"status"`
+	Queued              int       `json:"queued"`
+	Written             uint64    `json:"written"`
+	Failed              uint64    `json:"failed"`
+	Dropped             uint64    `json:"dropped"`
+	Spooled             uint64    `json:"spooled"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastSuccess         time.Time `json:"lastSuccess,omitempty"`
+	LastError           string    `json:"lastError,omitempty"`
+	LastErrorAt         time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// Batcher collects events for one sink and writes them in batches,
+// a batch is flushed when it is full or when the flush interval elapses
+type Batcher struct {
+	sink   Sink
+	opts   Options
+	log    *slog.Logger
+	events chan entity.GoodEvent
+
+	mu     sync.Mutex
+	health Health
+}
+
+func NewBatcher(log *slog.Logger, s Sink, opts Options) *Batcher {
+	opts = opts.withDefaults()
+
+	return &Batcher{
+		sink:   s,
+		opts:   opts,
+		log:    log.With(slog.String("sink", opts.Name)),
+		events: make(chan entity.GoodEvent, opts.QueueSize),
+		health: Health{
+			Name:   opts.Name,
+			Status: StatusOK,
+		},
+	}
+}
+
+// Add queues an event if it passes the sink filter. When the queue is full the event goes to the fallback
+// of the sink, or is dropped if it has none, so a slow sink never blocks the others.
+func (b *Batcher) Add(event entity.GoodEvent) {
+	if !b.opts.Filter.Match(event) {
+		return
+	}
+
+	select {
+	case b.events <- event:
+	default:
+		if fb, ok := b.sink.(Fallback); ok {
+			b.fallback(fb, []entity.GoodEvent{event}, "sink queue is full")
+			return
+		}
+
+		b.mu.Lock()
+		b.health.Dropped++
+		b.mu.Unlock()
+
+		b.log.Warn("sink queue is full, event dropped", slog.String("event_id", event.EventId))
+	}
+}
+
+// Run flushes batches until ctx is done, queued events are flushed before it returns.
+// Batches are written and retried by a writer goroutine, so retries never stop the queue from draining.
+func (b *Batcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batches := make(chan []entity.GoodEvent, 1)
+	written := make(chan struct{})
+
+	go func() {
+		defer close(written)
+		for batch := range batches {
+			b.flush(ctx, batch)
+		}
+	}()
+
+	batch := make([]entity.GoodEvent, 0, b.opts.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		b.send(batches, batch)
+		batch = make([]entity.GoodEvent, 0, b.opts.BatchSize)
+	}
+
+	for {
+		select {
+		case event := <-b.events:
+			batch = append(batch, event)
+			if len(batch) >= b.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-b.events:
+					batch = append(batch, event)
+				default:
+					flush()
+					close(batches)
+					<-written
+					return
+				}
+			}
+		}
+	}
+}
+
+// send hands a batch to the writer. A sink with a fallback gets the batch parked there while the writer is
+// still busy with earlier ones, the others wait for the writer so their events stay in order.
+func (b *Batcher) send(batches chan<- []entity.GoodEvent, batch []entity.GoodEvent) {
+	fb, ok := b.sink.(Fallback)
+	if !ok {
+		batches <- batch
+		return
+	}
+
+	select {
+	case batches <- batch:
+	default:
+		b.fallback(fb, batch, "sink writer is busy")
+	}
+}
+
+func (b *Batcher) flush(ctx context.Context, batch []entity.GoodEvent) {
+	var err error
+
+	// a write started during shutdown still gets to finish, only the retries stop once ctx is done
+	writeCtx := context.WithoutCancel(ctx)
+
+	backoff := b.opts.RetryBackoff
+retry:
+	for attempt := 1; attempt <= b.opts.RetryAttempts; attempt++ {
+		if err = b.sink.Write(writeCtx, batch); err == nil {
+			b.recordSuccess(len(batch))
+			return
+		}
+
+		b.log.Warn("sink write failed",
+			slog.Int("attempt", attempt),
+			slog.Int("events", len(batch)),
+			sl.Err(err),
+		)
+
+		if attempt == b.opts.RetryAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			break retry
+		}
+	}
+
+	b.recordFailure(len(batch), err)
+
+	fb, ok := b.sink.(Fallback)
+	if !ok {
+		b.log.Error("sink write failed, events lost", slog.Int("events", len(batch)), sl.Err(err))
+		return
+	}
+
+	b.fallback(fb, batch, "sink write failed")
+}
+
+// fallback parks events in the fallback of the sink, they are counted as dropped only if that fails too
+func (b *Batcher) fallback(fb Fallback, events []entity.GoodEvent, reason string) {
+	if err := fb.Fallback(events); err != nil {
+		b.mu.Lock()
+		b.health.Dropped += uint64(len(events))
+		b.mu.Unlock()
+
+		b.log.Error(reason+", sink fallback failed, events lost", slog.Int("events", len(events)), sl.Err(err))
+		return
+	}
+
+	b.mu.Lock()
+	b.health.Spooled += uint64(len(events))
+	b.mu.Unlock()
+
+	b.log.Warn(reason+", events moved to fallback", slog.Int("events", len(events)))
+}
+
+func (b *Batcher) recordSuccess(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.health.Written += uint64(n)
+	b.health.ConsecutiveFailures = 0
+	b.health.LastSuccess = time.Now()
+}
+
+func (b *Batcher) recordFailure(n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.health.Failed += uint64(n)
+	b.health.ConsecutiveFailures++
+	b.health.LastError = err.Error()
+	b.health.LastErrorAt = time.Now()
+}
+
+// Health returns a snapshot of the sink state
+func (b *Batcher) Health(ctx context.Context) Health {
+	b.mu.Lock()
+	health := b.health
+	b.mu.Unlock()
+
+	health.Queued = len(b.events)
+	health.Status = StatusOK
+	if health.ConsecutiveFailures > 0 {
+		health.Status = StatusFailing
+	}
+
+	if checker, ok := b.sink.(Checker); ok {
+		if err := checker.Check(ctx); err != nil {
+			health.Status = StatusDown
+			health.LastError = err.Error()
+		}
+	}
+
+	return health
+}
@@ -0,0 +1,32 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"hezzl_test/internal/entity"
+	"hezzl_test/internal/storage/clickhouse"
+)
+
+// ClickHouse writes events into the events table, batches that still fail after retries are spooled
+// to local files and backfilled once ClickHouse recovers
+type ClickHouse struct{}
+
+func NewClickHouse() *ClickHouse {
+	return &ClickHouse{}
+}
+
+func (c *ClickHouse) Write(_ context.Context, events []entity.GoodEvent) error {
+	return clickhouse.WriteBatch(events)
+}
+
+func (c *ClickHouse) Fallback(events []entity.GoodEvent) error {
+	return clickhouse.SpoolBatch(events)
+}
+
+func (c *ClickHouse) Check(_ context.Context) error {
+	if !clickhouse.Connected() {
+		return errors.New("clickhouse is not connected")
+	}
+
+	return nil
+}
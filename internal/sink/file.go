@@ -0,0 +1,29 @@
+package sink
+
+import (
+	"context"
+	"hezzl_test/internal/entity"
+	"hezzl_test/internal/spool"
+)
+
+// File appends events to rotating NDJSON files in a directory
+type File struct {
+	spool *spool.Spool
+}
+
+func NewFile(dir string, maxFileSize int64) (*File, error) {
+	s, err := spool.New(dir, maxFileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{spool: s}, nil
+}
+
+func (f *File) Write(_ context.Context, events []entity.GoodEvent) error {
+	return f.spool.Write(events)
+}
+
+func (f *File) Close() error {
+	return f.spool.Close()
+}
@@ -0,0 +1,26 @@
+package sink
+
+import (
+	"context"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/entity"
+)
+
+// RankIndex keeps the Redis rank index of goods current
+type RankIndex struct {
+	index *cache.RankIndex
+}
+
+func NewRankIndex(index *cache.RankIndex) *RankIndex {
+	return &RankIndex{index: index}
+}
+
+func (ri *RankIndex) Write(ctx context.Context, events []entity.GoodEvent) error {
+	for _, event := range events {
+		if err := ri.index.Apply(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"context"
+	"hezzl_test/internal/entity"
+	"sync"
+)
+
+// Router fans every event out to all configured sinks
+type Router struct {
+	batchers []*Batcher
+}
+
+func NewRouter(batchers ...*Batcher) *Router {
+	return &Router{batchers: batchers}
+}
+
+func (r *Router) Publish(event entity.GoodEvent) {
+	for _, b := range r.batchers {
+		b.Add(event)
+	}
+}
+
+// Run runs every sink until ctx is done and waits for the final flushes
+func (r *Router) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, b := range r.batchers {
+		wg.Add(1)
+		go func(b *Batcher) {
+			defer wg.Done()
+			b.Run(ctx)
+		}(b)
+	}
+
+	wg.Wait()
+}
+
+func (r *Router) Health(ctx context.Context) []Health {
+	health := make([]Health, 0, len(r.batchers))
+	for _, b := range r.batchers {
+		health = append(health, b.Health(ctx))
+	}
+
+	return health
+}
@@ -0,0 +1,97 @@
+package sink
+
+import (
+	"context"
+	"hezzl_test/internal/entity"
+	"time"
+)
+
+// Sink is a destination for goods events
+type Sink interface {
+	Write(ctx context.Context, events []entity.GoodEvent) error
+}
+
+// Fallback is implemented by sinks that can park a batch somewhere once all retries failed
+type Fallback interface {
+	Fallback(events []entity.GoodEvent) error
+}
+
+// Checker is implemented by sinks that can report the state of their destination
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Filter selects the events a sink receives, empty lists match everything
+type Filter struct {
+	Projects []int
+	Events   []string
+}
+
+func (f Filter) Match(event entity.GoodEvent) bool {
+	if len(f.Projects) > 0 && !containsInt(f.Projects, event.ProjectId) {
+		return false
+	}
+	if len(f.Events) > 0 && !containsString(f.Events, event.Type) {
+		return false
+	}
+
+	return true
+}
+
+// Options configures batching and retries of a single sink
+type Options struct {
+	Name          string
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+	RetryAttempts int
+	RetryBackoff  time.Duration
+	Filter        Filter
+}
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Second
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = time.Second
+)
+
+func (o Options) withDefaults() Options {
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultBatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultFlushInterval
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = o.BatchSize * 100
+	}
+	if o.RetryAttempts <= 0 {
+		o.RetryAttempts = defaultRetryAttempts
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = defaultRetryBackoff
+	}
+
+	return o
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,32 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"hezzl_test/internal/entity"
+	"io"
+	"sync"
+)
+
+// Stdout prints events as NDJSON, it is meant for local development
+type Stdout struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewStdout(w io.Writer) *Stdout {
+	return &Stdout{enc: json.NewEncoder(w)}
+}
+
+func (s *Stdout) Write(_ context.Context, events []entity.GoodEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		if err := s.enc.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
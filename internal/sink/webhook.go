@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hezzl_test/internal/entity"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultWebhookTimeout = 5 * time.Second
+
+// Webhook posts every batch as a JSON array to an HTTP endpoint
+type Webhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewWebhook(url string, headers map[string]string, timeout time.Duration) *Webhook {
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+
+	return &Webhook{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (wh *Webhook) Write(ctx context.Context, events []entity.GoodEvent) error {
+	const op = "sink.Webhook.Write"
+
+	body, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range wh.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: unexpected status %d", op, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hezzl_test/internal/entity"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	filePrefix = "events-"
+	fileSuffix = ".ndjson"
+
+	defaultMaxFileSize = 64 << 20 // 64 MiB
+	replayBatchSize    = 1000
+)
+
+// Spool appends event batches to rotating NDJSON files in a local directory,
+// so events survive while their real destination is unavailable
+type Spool struct {
+	dir         string
+	maxFileSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func New(dir string, maxFileSize int64) (*Spool, error) {
+	const op = "spool.New"
+
+	if maxFileSize <= 0 {
+		maxFileSize = defaultMaxFileSize
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Spool{
+		dir:         dir,
+		maxFileSize: maxFileSize,
+	}, nil
+}
+
+// Write appends events to the active file, starting a new one once it grows past the size limit
+func (s *Spool) Write(events []entity.GoodEvent) error {
+	const op = "spool.Write"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil || s.size >= s.maxFileSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	w := bufio.NewWriter(s.file)
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		n, err := w.Write(append(line, '\n'))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		s.size += int64(n)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Pending returns the number of spooled files waiting to be replayed
+func (s *Spool) Pending() (int, error) {
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(files), nil
+}
+
+// Replay hands spooled events to fn in batches, oldest file first.
+// A file is deleted once all of its events were accepted, the first failure
+// stops the replay and leaves the file in place for the next attempt. Batches
+// are cut the same way every time, so a batch sent twice is recognized by the
+// ClickHouse insert deduplication.
+func (s *Spool) Replay(fn func([]entity.GoodEvent) error) (int, error) {
+	const op = "spool.Replay"
+
+	// close the active file so everything written so far can be replayed,
+	// new writes go to a fresh file that is picked up next time
+	s.mu.Lock()
+	err := s.closeActive()
+	s.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var replayed int
+	for _, path := range files {
+		n, err := replayFile(path, fn)
+		replayed += n
+		if err != nil {
+			return replayed, fmt.Errorf("%s: %s: %w", op, filepath.Base(path), err)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return replayed, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return replayed, nil
+}
+
+// Close closes the active file
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closeActive()
+}
+
+func (s *Spool) rotate() error {
+	if err := s.closeActive(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s%d%s", filePrefix, time.Now().UnixNano(), fileSuffix)
+
+	file, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.file = file
+	s.size = 0
+
+	return nil
+}
+
+func (s *Spool) closeActive() error {
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	s.size = 0
+
+	return err
+}
+
+// files lists closed spool files, the names embed the creation time so lexical order is chronological
+func (s *Spool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	var active string
+	if s.file != nil {
+		active = s.file.Name()
+	}
+	s.mu.Unlock()
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+
+		path := filepath.Join(s.dir, name)
+		if path == active {
+			continue
+		}
+
+		files = append(files, path)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func replayFile(path string, fn func([]entity.GoodEvent) error) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	// lines are read whole whatever their length, a good with large attributes makes a long line
+	reader := bufio.NewReader(file)
+
+	var (
+		replayed int
+		batch    = make([]entity.GoodEvent, 0, replayBatchSize)
+	)
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return replayed, readErr
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var event entity.GoodEvent
+			// a line that does not parse is a torn last line after a crash, the rest of the file is still usable
+			if err := json.Unmarshal(line, &event); err == nil {
+				batch = append(batch, event)
+			}
+		}
+
+		if len(batch) == replayBatchSize {
+			if err := fn(batch); err != nil {
+				return replayed, err
+			}
+			replayed += len(batch)
+			batch = batch[:0]
+		}
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := fn(batch); err != nil {
+			return replayed, err
+		}
+		replayed += len(batch)
+	}
+
+	return replayed, nil
+}
@@ -2,23 +2,28 @@ package clickhouse
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/sirupsen/logrus"
 	"hezzl_test/internal/entity"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 var (
-	buffer        []entity.GoodEvent
-	mutex         sync.Mutex
-	maxBatchSize  = 100             // Максимальный размер батча
-	flushInterval = 5 * time.Second // Интервал для отправки данных
-	chDBConn      driver.Conn
+	chDBConn  driver.Conn
+	connMutex sync.RWMutex
 )
 
+// eventColumns are the columns an event is written to, in the order of eventRow
+const eventColumns = "EventId, Type, id, ProjectId, Name, Description, Priority, Removed, EventTime, Tags, Attributes, Fields"
+
 func SetupClickHouseConnection(host, port, user, password, dbName string) (driver.Conn, error) {
 	const op = "storage.clickhouse.SetupClickHouseConnection"
 
@@ -48,7 +53,7 @@ func SetupClickHouseConnection(host, port, user, password, dbName string) (drive
 		return nil, fmt.Errorf("%s : %w", op, err)
 	}
 
-	chDBConn = chDB
+	setConn(chDB)
 
 	return chDB, nil
 }
@@ -58,120 +63,521 @@ func InsertLogToClickHouse(chDB driver.Conn, event entity.GoodEvent) error {
 
 	ctx := context.Background()
 
+	row, err := eventRow(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = chDB.Exec(ctx, `
+		INSERT INTO events (`+eventColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, row...)
+	if err != nil {
+		return fmt.Errorf("failed to insert event to ClickHouse: %s: %w", op, err)
+	}
+	return nil
+}
+
+func InsertLogBatchToClickHouse(chDB driver.Conn, events []entity.GoodEvent) error {
+	const op = "storage.clickhouse.InsertLogBatchToClickHouse"
+	// a retried batch carries the same token, so ClickHouse drops it as a duplicate insert
+	ctx := clickhouse.Context(context.Background(), clickhouse.WithSettings(clickhouse.Settings{
+		"insert_deduplication_token": deduplicationToken(events),
+	}))
+
+	batch, err := chDB.PrepareBatch(ctx, "INSERT INTO events ("+eventColumns+")")
+	if err != nil {
+		return fmt.Errorf("%s: prepare batch: %w", op, err)
+	}
+
+	for _, event := range events {
+		row, err := eventRow(event)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := batch.Append(row...); err != nil {
+			return fmt.Errorf("%s: append to batch: %w", op, err)
+		}
+	}
+
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("%s: batch send: %w", op, err)
+	}
+
+	return nil
+}
+
+// eventRow is the values of the columns of an event. A patched event only fills the columns of
+// the fields it changed and lists them in Fields, the other events fill every column and leave Fields empty.
+func eventRow(event entity.GoodEvent) ([]any, error) {
+	fields := []string{}
+
+	if event.Type == entity.PatchedEvent {
+		good := entity.GoodsForList{Id: event.Id, ProjectId: event.ProjectId}
+		if err := entity.ApplyChanges(&good, event.Changes); err != nil {
+			return nil, err
+		}
+
+		for field := range event.Changes {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		event.Name, event.Description, event.GoodLabels = good.Name, good.Description, good.GoodLabels
+	}
+
 	removed := 0
 	if event.Removed {
 		removed = 1
 	}
 
-	createdAt := event.EventTime.Format("2006-01-02 15:04:05")
+	tags, attributes, err := labelValues(event.GoodLabels)
+	if err != nil {
+		return nil, err
+	}
 
-	err := chDB.Exec(ctx, `
-		INSERT INTO events (id, ProjectId, Name, Description, Priority, Removed, EventTime)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`,
+	return []any{
+		event.EventId,
+		event.Type,
 		event.Id,
 		event.ProjectId,
 		event.Name,
 		event.Description,
 		event.Priority,
 		removed,
-		createdAt,
+		event.EventTime.Format("2006-01-02 15:04:05"),
+		tags,
+		attributes,
+		fields,
+	}, nil
+}
+
+// deduplicationToken builds a stable token from the event ids of a batch
+func deduplicationToken(events []entity.GoodEvent) string {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.EventId)
+	}
+	sort.Strings(ids)
+
+	sum := sha256.Sum256([]byte(strings.Join(ids, ",")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// eventsTable is the schema of the events table.
+// ReplacingMergeTree collapses rows with the same sorting key, and EventId is part of it,
+// so redelivered events are merged away; queries that need exact counts use FINAL.
+// Fields lists the columns a patched event filled, it is empty for events carrying the whole good.
+func eventsTable(name string) string {
+	return `
+	CREATE TABLE IF NOT EXISTS ` + name + `(
+                        EventId UUID,
+                        Type LowCardinality(String),
+                        id Int32,
+                        ProjectId Int32,
+                        Name String,
+                        Description String,
+                        Priority Int32,
+                        Removed UInt8,
+                        EventTime DateTime,
+                        Tags Array(String),
+                        Attributes String,
+                        Fields Array(String)
+) ENGINE = ReplacingMergeTree()
+      ORDER BY (ProjectId, id, EventTime, EventId)
+      SETTINGS non_replicated_deduplication_window = 1000;
+	`
+}
+
+func CreateTableClickHouse(chDB driver.Conn) error {
+	const op = "storage.clickhouse.CreateTableClickHouse"
+
+	ctx := context.Background()
+
+	if err := chDB.Exec(ctx, eventsTable("events")); err != nil {
+		return fmt.Errorf("failed create ClickHouse table: %s: %w", op, err)
+	}
+
+	// tables created before event ids existed keep their engine until `app migrate-events`
+	// moves them, but still get the columns added since and the insert deduplication window
+	for _, query := range []string{
+		`ALTER TABLE events ADD COLUMN IF NOT EXISTS EventId UUID FIRST`,
+		`ALTER TABLE events MODIFY SETTING non_replicated_deduplication_window = 1000`,
+		`ALTER TABLE events ADD COLUMN IF NOT EXISTS Tags Array(String)`,
+		`ALTER TABLE events ADD COLUMN IF NOT EXISTS Attributes String`,
+		`ALTER TABLE events ADD COLUMN IF NOT EXISTS Fields Array(String)`,
+		`ALTER TABLE events ADD COLUMN IF NOT EXISTS Type LowCardinality(String) AFTER EventId`,
+	} {
+		if err := chDB.Exec(ctx, query); err != nil {
+			return fmt.Errorf("failed migrate ClickHouse table: %s: %w", op, err)
+		}
+	}
+	logrus.Info("Clickhouse table created")
+	return nil
+}
+
+// MigrateEventsTable copies the events of a table created before it was a ReplacingMergeTree into a new
+// table with the current schema and swaps the two, the old table is kept as events_before_migration.
+// Events written during the copy would stay in the old table, so nothing may write events meanwhile.
+// It reports whether the table had to be migrated.
+func MigrateEventsTable(ctx context.Context, chDB driver.Conn) (bool, error) {
+	const op = "storage.clickhouse.MigrateEventsTable"
+
+	var engine string
+	err := chDB.QueryRow(ctx, "SELECT engine FROM system.tables WHERE database = currentDatabase() AND name = 'events'").Scan(&engine)
+	if err != nil {
+		return false, fmt.Errorf("%s: engine: %w", op, err)
+	}
+	if strings.HasSuffix(engine, "ReplacingMergeTree") {
+		return false, nil
+	}
+
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS events_migrating",
+		eventsTable("events_migrating"),
+		// rows written before events had ids all have the zero id, they would be merged into one
+		`INSERT INTO events_migrating (` + eventColumns + `)
+		SELECT if(EventId = toUUID('00000000-0000-0000-0000-000000000000'), generateUUIDv4(), EventId),
+			Type, id, ProjectId, Name, Description, Priority, Removed, EventTime, Tags, Attributes, Fields
+		FROM events`,
+		"RENAME TABLE events TO events_before_migration, events_migrating TO events",
+	} {
+		if err := chDB.Exec(ctx, query); err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return true, nil
+}
+
+// EventFilter narrows the events read from ClickHouse, zero values mean no restriction
+type EventFilter struct {
+	ProjectId int
+	From      time.Time
+	To        time.Time
+}
+
+// StreamEvents reads events matching the filter in event time order and passes them to fn one by one,
+// rows are fetched from ClickHouse block by block, so the result set is never held in memory
+func StreamEvents(ctx context.Context, chDB driver.Conn, filter EventFilter, fn func(entity.GoodEvent) error) error {
+	const op = "storage.clickhouse.StreamEvents"
+
+	var (
+		conditions []string
+		args       []any
 	)
+
+	if filter.ProjectId != 0 {
+		conditions = append(conditions, "ProjectId = ?")
+		args = append(args, filter.ProjectId)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "EventTime >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "EventTime < ?")
+		args = append(args, filter.To)
+	}
+
+	query := "SELECT toString(EventId), Type, id, ProjectId, Name, Description, Priority, Removed, EventTime, Tags, Attributes, Fields FROM events FINAL"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY EventTime, toString(EventId), id"
+
+	rows, err := chDB.Query(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to insert event to ClickHouse: %s: %w", op, err)
+		return fmt.Errorf("%s: query: %w", op, err)
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			event     entity.GoodEvent
+			id        int32
+			projectId int32
+			priority  int32
+			removed   uint8
+			labels    labelsScan
+		)
+
+		if err := rows.Scan(
+			&event.EventId,
+			&event.Type,
+			&id,
+			&projectId,
+			&event.Name,
+			&event.Description,
+			&priority,
+			&removed,
+			&event.EventTime,
+			&labels.tags,
+			&labels.attributes,
+			&labels.fields,
+		); err != nil {
+			return fmt.Errorf("%s: scan: %w", op, err)
+		}
+
+		event.Id = int(id)
+		event.ProjectId = int(projectId)
+		event.Priority = int(priority)
+		event.Removed = removed == 1
+		if event.GoodLabels, err = labels.labels(); err != nil {
+			return fmt.Errorf("%s: labels: %w", op, err)
+		}
+		labels.patch(&event)
+
+		if err := fn(event); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: rows: %w", op, err)
+	}
+
 	return nil
 }
 
-func BufferEvent(event entity.GoodEvent) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	buffer = append(buffer, event)
+// LatestEvents returns the most recent event of every good, keyed by good id, projectId 0 means every project.
+// EventTime only has seconds, events of the same second are ordered by their id, ids are UUIDv7,
+// compared as strings since ClickHouse does not compare UUID values in byte order.
+// Patched events only carry some fields, every field comes from the latest event that has it.
+func LatestEvents(ctx context.Context, chDB driver.Conn, projectId int) (map[int]entity.GoodEvent, error) {
+	const op = "storage.clickhouse.LatestEvents"
+
+	query := `
+	SELECT
+		id,
+		argMax(ProjectId, (EventTime, toString(EventId))),
+		argMax(toString(EventId), (EventTime, toString(EventId))),
+		argMaxIf(Name, (EventTime, toString(EventId)), empty(Fields) OR has(Fields, 'name')),
+		argMaxIf(Description, (EventTime, toString(EventId)), empty(Fields) OR has(Fields, 'description')),
+		argMaxIf(Priority, (EventTime, toString(EventId)), empty(Fields)),
+		argMaxIf(Removed, (EventTime, toString(EventId)), empty(Fields)),
+		max(EventTime),
+		argMaxIf(Tags, (EventTime, toString(EventId)), empty(Fields) OR has(Fields, 'tags')),
+		argMaxIf(Attributes, (EventTime, toString(EventId)), empty(Fields) OR has(Fields, 'attributes'))
+	FROM events FINAL`
 
-	if len(buffer) >= maxBatchSize {
-		flushBuffer()
+	var args []any
+	if projectId != 0 {
+		query += " WHERE ProjectId = ?"
+		args = append(args, projectId)
 	}
-}
+	query += " GROUP BY id"
 
-func flushBuffer() {
-	if len(buffer) == 0 {
-		return
+	rows, err := chDB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
 	}
+	defer rows.Close()
+
+	latest := make(map[int]entity.GoodEvent)
+	for rows.Next() {
+		var (
+			event    entity.GoodEvent
+			id       int32
+			project  int32
+			priority int32
+			removed  uint8
+			labels   labelsScan
+		)
+
+		if err := rows.Scan(
+			&id,
+			&project,
+			&event.EventId,
+			&event.Name,
+			&event.Description,
+			&priority,
+			&removed,
+			&event.EventTime,
+			&labels.tags,
+			&labels.attributes,
+		); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
 
-	eventsToFlush := make([]entity.GoodEvent, len(buffer))
-	copy(eventsToFlush, buffer)
-	buffer = make([]entity.GoodEvent, 0)
+		event.Id = int(id)
+		event.ProjectId = int(project)
+		event.Priority = int(priority)
+		event.Removed = removed == 1
+		if event.GoodLabels, err = labels.labels(); err != nil {
+			return nil, fmt.Errorf("%s: labels: %w", op, err)
+		}
 
-	go InsertLogBatchToClickHouse(chDBConn, eventsToFlush)
+		latest[event.Id] = event
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+
+	return latest, nil
 }
 
-func StartFlusher() {
-	ticker := time.NewTicker(flushInterval)
-	defer ticker.Stop()
+// MostActiveProjects returns up to limit projects ordered by the number of their events since the given time
+func MostActiveProjects(ctx context.Context, chDB driver.Conn, limit int, since time.Time) ([]int, error) {
+	const op = "storage.clickhouse.MostActiveProjects"
 
-	for {
-		<-ticker.C
-		mutex.Lock()
-		flushBuffer()
-		mutex.Unlock()
+	rows, err := chDB.Query(ctx, `
+	SELECT ProjectId
+	FROM events
+	WHERE EventTime >= ?
+	GROUP BY ProjectId
+	ORDER BY uniqExact(EventId) DESC
+	LIMIT ?`, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
 	}
+	defer rows.Close()
+
+	projects := make([]int, 0, limit)
+	for rows.Next() {
+		var projectId int32
+		if err := rows.Scan(&projectId); err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		projects = append(projects, int(projectId))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+
+	return projects, nil
 }
 
-func InsertLogBatchToClickHouse(chDB driver.Conn, events []entity.GoodEvent) error {
-	const op = "storage.clickhouse.InsertLogBatchToClickHouse"
-	ctx := context.Background()
+// GoodsHistory returns up to limit most recent events of each of the given goods, newest first, keyed by good id
+func GoodsHistory(ctx context.Context, chDB driver.Conn, ids []int, limit int) (map[int][]entity.GoodEvent, error) {
+	const op = "storage.clickhouse.GoodsHistory"
+
+	goodIds := make([]int32, len(ids))
+	for i, id := range ids {
+		goodIds[i] = int32(id)
+	}
 
-	batch, err := chDB.PrepareBatch(ctx, "INSERT INTO events (id, ProjectId, Name, Description, Priority, Removed, EventTime)")
+	rows, err := chDB.Query(ctx, `
+	SELECT toString(EventId), Type, id, ProjectId, Name, Description, Priority, Removed, EventTime, Tags, Attributes, Fields
+	FROM events FINAL
+	WHERE id IN ?
+	ORDER BY id, EventTime DESC, toString(EventId) DESC
+	LIMIT ? BY id`, goodIds, limit)
 	if err != nil {
-		return fmt.Errorf("%s: prepare batch: %w", op, err)
+		return nil, fmt.Errorf("%s: query: %w", op, err)
 	}
+	defer rows.Close()
 
-	for _, event := range events {
-		removed := 0
-		if event.Removed {
-			removed = 1
-		}
-		createdAt := event.EventTime.Format("2006-01-02 15:04:05")
-		if err := batch.Append(
-			event.Id,
-			event.ProjectId,
-			event.Name,
-			event.Description,
-			event.Priority,
-			removed,
-			createdAt,
+	history := make(map[int][]entity.GoodEvent, len(ids))
+	for rows.Next() {
+		var (
+			event     entity.GoodEvent
+			id        int32
+			projectId int32
+			priority  int32
+			removed   uint8
+			labels    labelsScan
+		)
+
+		if err := rows.Scan(
+			&event.EventId,
+			&event.Type,
+			&id,
+			&projectId,
+			&event.Name,
+			&event.Description,
+			&priority,
+			&removed,
+			&event.EventTime,
+			&labels.tags,
+			&labels.attributes,
+			&labels.fields,
 		); err != nil {
-			return fmt.Errorf("%s: append to batch: %w", op, err)
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
 		}
+
+		event.Id = int(id)
+		event.ProjectId = int(projectId)
+		event.Priority = int(priority)
+		event.Removed = removed == 1
+		if event.GoodLabels, err = labels.labels(); err != nil {
+			return nil, fmt.Errorf("%s: labels: %w", op, err)
+		}
+		labels.patch(&event)
+
+		history[event.Id] = append(history[event.Id], event)
 	}
 
-	if err := batch.Send(); err != nil {
-		return fmt.Errorf("%s: batch send: %w", op, err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
 	}
 
-	return nil
+	return history, nil
 }
 
-func CreateTableClickHouse(chDB driver.Conn) error {
-	const op = "storage.clickhouse.CreateTableClickHouse"
+// labelValues are the Tags and Attributes columns of an event, attributes are stored as a JSON object
+func labelValues(labels entity.GoodLabels) ([]string, string, error) {
+	tags := labels.Tags
+	if tags == nil {
+		tags = []string{}
+	}
 
-	ctx := context.Background()
+	if labels.Attributes == nil {
+		return tags, "{}", nil
+	}
 
-	err := chDB.Exec(ctx, `
-	CREATE TABLE IF NOT EXISTS events(
-                        id Int32,
-                        ProjectId Int32,
-                        Name String,
-                        Description String,
-                        Priority Int32,
-                        Removed UInt8,
-                        EventTime DateTime
-) ENGINE = MergeTree()
-      ORDER BY (id, ProjectId, Name);
-	`)
+	attributes, err := json.Marshal(labels.Attributes)
 	if err != nil {
-		return fmt.Errorf("failed create ClickHouse table: %s: %w", op, err)
+		return nil, "", err
+	}
+
+	return tags, string(attributes), nil
+}
+
+// labelsScan holds the Tags, Attributes and Fields columns of a row until they are decoded
+type labelsScan struct {
+	tags       []string
+	attributes string
+	fields     []string
+}
+
+// labels decodes the scanned columns, rows written before the columns existed have empty labels
+func (ls *labelsScan) labels() (entity.GoodLabels, error) {
+	labels := entity.GoodLabels{Tags: ls.tags, Attributes: map[string]any{}}
+	if labels.Tags == nil {
+		labels.Tags = []string{}
+	}
+
+	if ls.attributes != "" {
+		if err := json.Unmarshal([]byte(ls.attributes), &labels.Attributes); err != nil {
+			return labels, err
+		}
+	}
+
+	return labels, nil
+}
+
+// patch turns the event of a row written by a patch back into a patched event with its changes
+func (ls *labelsScan) patch(event *entity.GoodEvent) {
+	if len(ls.fields) == 0 {
+		return
+	}
+
+	event.Type = entity.PatchedEvent
+	event.Changes = make(map[string]any, len(ls.fields))
+	for _, field := range ls.fields {
+		switch field {
+		case "name":
+			event.Changes[field] = event.Name
+		case "description":
+			event.Changes[field] = event.Description
+		case "tags":
+			event.Changes[field] = event.Tags
+		case "attributes":
+			event.Changes[field] = event.Attributes
+		}
 	}
-	logrus.Info("Clickhouse table created")
-	return nil
 }
@@ -0,0 +1,147 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/sirupsen/logrus"
+	"hezzl_test/internal/entity"
+	"hezzl_test/internal/spool"
+	"time"
+)
+
+var (
+	fallback *spool.Spool
+
+	errNoConnection = errors.New("clickhouse connection is not established")
+)
+
+// SetSpool sets the local spool used for batches that could not be inserted
+func SetSpool(s *spool.Spool) {
+	fallback = s
+}
+
+// Connected reports whether a ClickHouse connection is established
+func Connected() bool {
+	return conn() != nil
+}
+
+func conn() driver.Conn {
+	connMutex.RLock()
+	defer connMutex.RUnlock()
+
+	return chDBConn
+}
+
+func setConn(chDB driver.Conn) {
+	connMutex.Lock()
+	defer connMutex.Unlock()
+
+	chDBConn = chDB
+}
+
+// WriteBatch inserts a batch using the current connection
+func WriteBatch(events []entity.GoodEvent) error {
+	chDB := conn()
+	if chDB == nil {
+		return errNoConnection
+	}
+
+	return InsertLogBatchToClickHouse(chDB, events)
+}
+
+// TopProjects returns the most active projects using the current connection
+func TopProjects(ctx context.Context, limit int, since time.Time) ([]int, error) {
+	chDB := conn()
+	if chDB == nil {
+		return nil, errNoConnection
+	}
+
+	return MostActiveProjects(ctx, chDB, limit, since)
+}
+
+// History returns the recent events of goods using the current connection
+func History(ctx context.Context, ids []int, limit int) (map[int][]entity.GoodEvent, error) {
+	chDB := conn()
+	if chDB == nil {
+		return nil, errNoConnection
+	}
+
+	return GoodsHistory(ctx, chDB, ids, limit)
+}
+
+// SpoolBatch stores a batch in the local spool, it is backfilled once ClickHouse recovers
+func SpoolBatch(events []entity.GoodEvent) error {
+	if fallback == nil {
+		return errors.New("event spool is not configured")
+	}
+
+	return fallback.Write(events)
+}
+
+// KeepConnecting retries connecting to ClickHouse until it succeeds and then prepares the events table,
+// it is used when ClickHouse was unavailable at startup
+func KeepConnecting(host, port, user, password, dbName string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+
+		chDB, err := SetupClickHouseConnection(host, port, user, password, dbName)
+		if err != nil {
+			logrus.WithError(err).Warn("ClickHouse is still unavailable")
+			continue
+		}
+
+		if err := CreateTableClickHouse(chDB); err != nil {
+			logrus.WithError(err).Error("failed create ClickHouse table")
+		}
+
+		logrus.Info("ClickHouse connection established")
+
+		return
+	}
+}
+
+// StartBackfill periodically loads spooled batches into ClickHouse once it is reachable
+func StartBackfill(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+
+		if fallback == nil {
+			continue
+		}
+
+		chDB := conn()
+		if chDB == nil {
+			continue
+		}
+
+		pending, err := fallback.Pending()
+		if err != nil {
+			logrus.WithError(err).Error("failed to list spooled events")
+			continue
+		}
+
+		if err := chDB.Ping(context.Background()); err != nil {
+			if pending > 0 {
+				logrus.WithError(err).Warnf("ClickHouse is unavailable, %d spool files waiting", pending)
+			}
+			continue
+		}
+
+		replayed, err := fallback.Replay(func(events []entity.GoodEvent) error {
+			return InsertLogBatchToClickHouse(chDB, events)
+		})
+		if replayed > 0 {
+			logrus.Infof("backfilled %d spooled events into ClickHouse", replayed)
+		}
+		if err != nil {
+			logrus.WithError(err).Warn("backfill interrupted")
+		}
+	}
+}
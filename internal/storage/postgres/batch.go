@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hezzl_test/internal/entity"
+)
+
+// ErrRefFailed is the error of an operation whose Ref names an operation that failed
+var ErrRefFailed = errors.New("referenced operation failed")
+
+// BatchResult is the outcome of an operation of a batch, Good is the good after it
+type BatchResult struct {
+	Good              entity.GoodsForList
+	PreviousProjectId int // set by move
+	Err               error
+}
+
+// BatchError is returned by an atomic batch that was rolled back, Index is the operation that failed
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %s", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// Batch runs the operations in order in one transaction. An atomic batch stops at the first failing
+// operation and is rolled back, its error is a *BatchError. Otherwise every operation runs in a savepoint,
+// a failing one is rolled back alone, its error is in its result, and the others are committed.
+// The operations are expected to be validated, the storage checks only what needs the database.
+func (s *Storage) Batch(ops []entity.BatchOperation, atomic bool) ([]BatchResult, error) {
+	const op = "storage.postgres.Batch"
+
+	results := make([]BatchResult, len(ops))
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// the project a good of the batch is in after the operations so far, refs follow moves
+	projects := make(map[int]int)
+
+	for i, operation := range ops {
+		if !atomic {
+			if _, err := tx.Exec(`SAVEPOINT batch_operation`); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		result, err := s.batchOperation(tx, operation, results, projects)
+		if err != nil {
+			if atomic {
+				return nil, &BatchError{Index: i, Err: err}
+			}
+
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT batch_operation`); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			results[i] = BatchResult{Err: err}
+			continue
+		}
+
+		if !atomic {
+			if _, err := tx.Exec(`RELEASE SAVEPOINT batch_operation`); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		results[i] = result
+		projects[result.Good.Id] = result.Good.ProjectId
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return results, nil
+}
+
+// batchOperation runs an operation of a batch and reads the good after it
+func (s *Storage) batchOperation(tx *sql.Tx, operation entity.BatchOperation, results []BatchResult, projects map[int]int) (BatchResult, error) {
+	const op = "storage.postgres.batchOperation"
+
+	var result BatchResult
+
+	id, projectId := operation.Id, operation.ProjectId
+	if operation.Ref != nil {
+		ref := results[*operation.Ref]
+		if ref.Err != nil {
+			return result, ErrRefFailed
+		}
+		id, projectId = ref.Good.Id, projects[ref.Good.Id]
+	}
+
+	var err error
+	switch operation.Op {
+	case "create":
+		var created entity.GoodCreateResponse
+		created, err = s.createGood(tx, projectId, *operation.Name, operation.GoodLabels)
+		id = created.Id
+	case "update":
+		var description string
+		if operation.Description != nil {
+			description = *operation.Description
+		}
+		_, err = updateGood(tx, id, projectId, *operation.Name, description, operation.GoodLabels)
+	case "remove":
+		_, _, _, _, _, err = deleteGood(tx, id, projectId)
+	case "reprioritize":
+		_, _, _, err = s.reprioritize(tx, id, projectId, *operation.NewPriority)
+	case "move":
+		_, err = s.moveGood(tx, id, projectId, *operation.NewProjectId)
+		result.PreviousProjectId = projectId
+	default:
+		return result, fmt.Errorf("%s: unknown operation %q", op, operation.Op)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result.Good, err = goodInTx(tx, id)
+	if err != nil {
+		return result, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result, nil
+}
+
+// goodInTx reads a good with the changes tx made so far
+func goodInTx(tx *sql.Tx, id int) (entity.GoodsForList, error) {
+	var (
+		good        entity.GoodsForList
+		description sql.NullString
+		labels      labelsScan
+	)
+
+	err := tx.QueryRow(`
+		SELECT id, project_id, name, description, priority, removed, created_at,`+labelColumns("goods")+`
+		FROM goods
+		WHERE id = $1`, id).Scan(
+		&good.Id,
+		&good.ProjectId,
+		&good.Name,
+		&description,
+		&good.Priority,
+		&good.Removed,
+		&good.CreatedAt,
+		&labels.tags,
+		&labels.attributes,
+	)
+	if err != nil {
+		return good, err
+	}
+
+	good.Description = description.String
+
+	good.GoodLabels, err = labels.labels()
+
+	return good, err
+}
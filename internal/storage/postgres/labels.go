@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"hezzl_test/internal/entity"
+	"sort"
+	"strings"
+)
+
+// labelColumns selects the tags and the attributes of the goods row named table, they are scanned into a labelsScan
+func labelColumns(table string) string {
+	return fmt.Sprintf(`
+		ARRAY(SELECT t.name FROM good_tags gt JOIN tags t ON t.id = gt.tag_id WHERE gt.good_id = %[1]s.id ORDER BY t.name),
+		%[1]s.attributes`, table)
+}
+
+// labelsScan holds the label columns of a row until they are decoded
+type labelsScan struct {
+	tags       pq.StringArray
+	attributes []byte
+}
+
+// labels decodes the scanned columns, a good without tags or attributes has empty ones rather than nil
+func (ls *labelsScan) labels() (entity.GoodLabels, error) {
+	labels := entity.GoodLabels{Tags: []string(ls.tags), Attributes: map[string]any{}}
+	if labels.Tags == nil {
+		labels.Tags = []string{}
+	}
+
+	if len(ls.attributes) > 0 {
+		if err := json.Unmarshal(ls.attributes, &labels.Attributes); err != nil {
+			return labels, err
+		}
+	}
+
+	return labels, nil
+}
+
+// setLabels replaces the tags and the attributes of a good, nil ones are left as they are.
+// Tags are expected normalized, unknown tags are created.
+func setLabels(tx *sql.Tx, goodId int, labels entity.GoodLabels) error {
+	const op = "storage.postgres.setLabels"
+
+	if labels.Tags != nil {
+		_, err := tx.Exec(`INSERT INTO tags (name) SELECT unnest($1::varchar[]) ON CONFLICT (name) DO NOTHING`, pq.Array(labels.Tags))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, err = tx.Exec(`DELETE FROM good_tags WHERE good_id = $1`, goodId)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO good_tags (good_id, tag_id) SELECT $1, id FROM tags WHERE name = ANY($2)`, goodId, pq.Array(labels.Tags))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if labels.Attributes != nil {
+		attributes, err := json.Marshal(labels.Attributes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, err = tx.Exec(`UPDATE goods SET attributes = $2::jsonb WHERE id = $1`, goodId, string(attributes))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// labelsInTx reads the tags and the attributes of a good with the changes tx made so far
+func labelsInTx(tx *sql.Tx, goodId int) (entity.GoodLabels, error) {
+	const op = "storage.postgres.labelsInTx"
+
+	var scan labelsScan
+
+	err := tx.QueryRow(`SELECT `+labelColumns("goods")+` FROM goods WHERE id = $1`, goodId).Scan(&scan.tags, &scan.attributes)
+	if err != nil {
+		return entity.GoodLabels{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	labels, err := scan.labels()
+	if err != nil {
+		return labels, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return labels, nil
+}
+
+// filterConditions turns a filter into conditions on the goods table, joined by AND,
+// their placeholders are numbered after the args already there
+func filterConditions(filter entity.GoodsFilter, args []any) (string, []any) {
+	var conditions []string
+
+	if len(filter.Tags) > 0 {
+		args = append(args, pq.Array(filter.Tags), len(filter.Tags))
+		conditions = append(conditions, fmt.Sprintf(`goods.id IN (
+		SELECT gt.good_id FROM good_tags gt JOIN tags t ON t.id = gt.tag_id
+		WHERE t.name = ANY($%d)
+		GROUP BY gt.good_id
+		HAVING COUNT(*) = $%d)`, len(args)-1, len(args)))
+	}
+
+	keys := make([]string, 0, len(filter.Attributes))
+	for key := range filter.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// containment is what the GIN index serves, a value that reads as a number or a boolean
+	// also matches attributes stored with that type
+	for _, key := range keys {
+		var alternatives []string
+		for _, value := range attributeValues(filter.Attributes[key]) {
+			document, _ := json.Marshal(map[string]any{key: value})
+			args = append(args, string(document))
+			alternatives = append(alternatives, fmt.Sprintf("goods.attributes @> $%d::jsonb", len(args)))
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return "AND " + strings.Join(conditions, "\n\t  AND "), args
+}
+
+// attributeValues are the JSON values a value of a query string may be stored as
+func attributeValues(value string) []any {
+	values := []any{value}
+
+	var decoded any
+	if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+		switch decoded.(type) {
+		case float64, bool:
+			values = append(values, decoded)
+		}
+	}
+
+	return values
+}
@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pressly/goose"
 	"hezzl_test/internal/entity"
 	"log"
@@ -13,9 +13,24 @@ import (
 
 type Storage struct {
 	db *sql.DB
+
+	defaultQuota  Quota
+	projectQuotas map[int]Quota
 }
 
-var ErrNotFound = errors.New("record not found")
+var (
+	ErrNotFound        = errors.New("record not found")
+	ErrProjectNotFound = errors.New("project not found")
+)
+
+// PriorityRangeError is returned when a new priority is past the last good of the project
+type PriorityRangeError struct {
+	Max int
+}
+
+func (e *PriorityRangeError) Error() string {
+	return fmt.Sprintf("priority is out of range, the last one of the project is %d", e.Max)
+}
 
 func New(host, port, user, password, dbName string) (*Storage, error) {
 	const op = "storage.postgres.New"
@@ -47,22 +62,50 @@ func New(host, port, user, password, dbName string) (*Storage, error) {
 	return storage, nil
 }
 
-func (s *Storage) CreateGood(projectId int, name string) (entity.GoodCreateResponse, error) {
+func (s *Storage) CreateGood(projectId int, name string, labels entity.GoodLabels) (entity.GoodCreateResponse, error) {
 	const op = "storage.postgres.CreateGood"
 
+	var response entity.GoodCreateResponse
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return response, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	response, err = s.createGood(tx, projectId, name, labels)
+	if err != nil {
+		return response, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return response, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return response, nil
+}
+
+func (s *Storage) createGood(tx *sql.Tx, projectId int, name string, labels entity.GoodLabels) (entity.GoodCreateResponse, error) {
+	const op = "storage.postgres.createGood"
+
 	var response entity.GoodCreateResponse
 	var description sql.NullString
 
 	query := `
-		INSERT INTO goods (project_id, name) VALUES ($1, $2) RETURNING *;
+		INSERT INTO goods (project_id, name) VALUES ($1, $2)
+		RETURNING id, project_id, name, description, priority, removed, created_at;
 		`
 
-	tx, err := s.db.Begin()
-	if err != nil {
-		return response, fmt.Errorf("%s: %w", op, err)
+	if err := checkProjectExists(tx, projectId); err != nil {
+		return response, err
 	}
 
-	err = tx.QueryRow(query, projectId, name).Scan(&response.Id,
+	if err := s.checkGoodsQuota(tx, projectId); err != nil {
+		return response, err
+	}
+
+	err := tx.QueryRow(query, projectId, name).Scan(&response.Id,
 		&response.ProjectId,
 		&response.Name,
 		&description,
@@ -70,7 +113,6 @@ func (s *Storage) CreateGood(projectId int, name string) (entity.GoodCreateRespo
 		&response.Removed,
 		&response.CreatedAt)
 	if err != nil {
-		tx.Rollback()
 		return response, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -80,29 +122,54 @@ func (s *Storage) CreateGood(projectId int, name string) (entity.GoodCreateRespo
 		response.Description = ""
 	}
 
-	err = tx.Commit()
+	if err := setLabels(tx, response.Id, labels); err != nil {
+		return response, err
+	}
+
+	response.GoodLabels, err = labelsInTx(tx, response.Id)
 	if err != nil {
-		return response, fmt.Errorf("%s: %w", op, err)
+		return response, err
 	}
 
 	return response, nil
 }
 
-func (s *Storage) UpdateGood(id, projectId int, name, description string) (entity.GoodUpdateResponse, error) {
+// UpdateGood replaces the name and the description of a good, and the labels that are not nil
+func (s *Storage) UpdateGood(id, projectId int, name, description string, labels entity.GoodLabels) (entity.GoodUpdateResponse, error) {
 	const op = "storage.postgres.UpdateGood"
 
 	var response entity.GoodUpdateResponse
 
-	query := `
-		UPDATE goods SET name = $1, description = $2 WHERE id = $3 AND project_id = $4 RETURNING *;
-		`
-
 	tx, err := s.db.Begin()
 	if err != nil {
 		return response, fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback()
+
+	response, err = updateGood(tx, id, projectId, name, description, labels)
+	if err != nil {
+		return response, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return response, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return response, nil
+}
 
-	err = tx.QueryRow(query, name, description, id, projectId).Scan(&response.Id,
+func updateGood(tx *sql.Tx, id, projectId int, name, description string, labels entity.GoodLabels) (entity.GoodUpdateResponse, error) {
+	const op = "storage.postgres.updateGood"
+
+	var response entity.GoodUpdateResponse
+
+	query := `
+		UPDATE goods SET name = $1, description = $2 WHERE id = $3 AND project_id = $4
+		RETURNING id, project_id, name, description, priority, removed, created_at;
+		`
+
+	err := tx.QueryRow(query, name, description, id, projectId).Scan(&response.Id,
 		&response.ProjectId,
 		&response.Name,
 		&response.Description,
@@ -113,55 +180,140 @@ func (s *Storage) UpdateGood(id, projectId int, name, description string) (entit
 		if err == sql.ErrNoRows {
 			return response, ErrNotFound
 		}
-		tx.Rollback()
 		return response, fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = tx.Commit()
+	if err := setLabels(tx, id, labels); err != nil {
+		return response, err
+	}
+
+	response.GoodLabels, err = labelsInTx(tx, id)
 	if err != nil {
-		return response, fmt.Errorf("%s: %w", op, err)
+		return response, err
 	}
 
 	return response, nil
 }
 
-func (s *Storage) DeleteGood(id, projectId int) (entity.GoodRemoveResponse, string, string, int, error) {
+// PatchGood changes the name, the description and the labels of a good to what apply returns for the current good.
+// The good is locked while apply runs, so patches that test the current values see what they change.
+// Errors of apply are returned as they are.
+func (s *Storage) PatchGood(id, projectId int, apply func(entity.GoodDocument) (entity.GoodDocument, error)) (entity.GoodDocument, entity.GoodDocument, error) {
+	const op = "storage.postgres.PatchGood"
+
+	var (
+		before, after entity.GoodDocument
+		labels        labelsScan
+	)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return before, after, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		SELECT id, project_id, name, description, priority, removed, created_at,`+labelColumns("goods")+`
+		FROM goods
+		WHERE id = $1 AND project_id = $2
+		FOR UPDATE OF goods`, id, projectId).Scan(
+		&before.Id,
+		&before.ProjectId,
+		&before.Name,
+		&before.Description,
+		&before.Priority,
+		&before.Removed,
+		&before.CreatedAt,
+		&labels.tags,
+		&labels.attributes,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return before, after, ErrNotFound
+		}
+		return before, after, fmt.Errorf("%s: %w", op, err)
+	}
+
+	before.GoodLabels, err = labels.labels()
+	if err != nil {
+		return before, after, fmt.Errorf("%s: %w", op, err)
+	}
+
+	after, err = apply(before)
+	if err != nil {
+		return before, after, err
+	}
+
+	_, err = tx.Exec(`UPDATE goods SET name = $1, description = $2 WHERE id = $3 AND project_id = $4`,
+		after.Name, after.Description, id, projectId)
+	if err != nil {
+		return before, after, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := setLabels(tx, id, after.GoodLabels); err != nil {
+		return before, after, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return before, after, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return before, after, nil
+}
+
+// DeleteGood marks a good removed and returns its name, description, priority and labels for the event
+func (s *Storage) DeleteGood(id, projectId int) (entity.GoodRemoveResponse, string, string, int, entity.GoodLabels, error) {
 	const op = "storage.postgres.DeleteGood"
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return entity.GoodRemoveResponse{}, "", "", 0, entity.GoodLabels{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	response, name, description, priority, labels, err := deleteGood(tx, id, projectId)
+	if err != nil {
+		return response, name, description, priority, labels, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return response, name, description, priority, labels, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return response, name, description, priority, labels, nil
+}
+
+func deleteGood(tx *sql.Tx, id, projectId int) (entity.GoodRemoveResponse, string, string, int, entity.GoodLabels, error) {
+	const op = "storage.postgres.deleteGood"
+
 	var (
 		response       entity.GoodRemoveResponse
 		name           string
 		descriptionStr string
 		description    sql.NullString
 		priority       int
+		labels         labelsScan
+		goodLabels     entity.GoodLabels
 	)
 
 	query := `
-		UPDATE goods SET removed = true WHERE id = $1 AND project_id = $2 RETURNING id, project_id, name, description, priority, removed;
+		UPDATE goods SET removed = true WHERE id = $1 AND project_id = $2 RETURNING id, project_id, name, description, priority, removed,` + labelColumns("goods") + `;
 		`
 
-	tx, err := s.db.Begin()
-	if err != nil {
-		return response, name, descriptionStr, priority, fmt.Errorf("%s: %w", op, err)
-	}
-
-	err = tx.QueryRow(query, id, projectId).Scan(&response.Id,
+	err := tx.QueryRow(query, id, projectId).Scan(&response.Id,
 		&response.ProjectId,
 		&name,
 		&description,
 		&priority,
-		&response.Removed)
+		&response.Removed,
+		&labels.tags,
+		&labels.attributes)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return response, name, descriptionStr, priority, ErrNotFound
+			return response, name, descriptionStr, priority, goodLabels, ErrNotFound
 		}
-		tx.Rollback()
-		return response, name, descriptionStr, priority, fmt.Errorf("%s: %w", op, err)
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		return response, name, descriptionStr, priority, fmt.Errorf("%s: %w", op, err)
+		return response, name, descriptionStr, priority, goodLabels, fmt.Errorf("%s: %w", op, err)
 	}
 
 	if description.Valid {
@@ -170,7 +322,12 @@ func (s *Storage) DeleteGood(id, projectId int) (entity.GoodRemoveResponse, stri
 		descriptionStr = ""
 	}
 
-	return response, name, descriptionStr, priority, nil
+	goodLabels, err = labels.labels()
+	if err != nil {
+		return response, name, descriptionStr, priority, goodLabels, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return response, name, descriptionStr, priority, goodLabels, nil
 }
 
 func (s *Storage) GetGoodByID(key int) (entity.GoodsForList, error) {
@@ -178,10 +335,10 @@ func (s *Storage) GetGoodByID(key int) (entity.GoodsForList, error) {
 
 	var response entity.GoodsForList
 	var description sql.NullString
+	var labels labelsScan
 
 	query := `
-	SELECT 
-	    *
+	SELECT id, project_id, name, description, priority, removed, created_at,` + labelColumns("goods") + `
 	FROM goods
 	WHERE id = $1;
 	`
@@ -194,8 +351,13 @@ func (s *Storage) GetGoodByID(key int) (entity.GoodsForList, error) {
 		&response.Priority,
 		&response.Removed,
 		&response.CreatedAt,
+		&labels.tags,
+		&labels.attributes,
 	)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return response, ErrNotFound
+		}
 		return response, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -205,53 +367,169 @@ func (s *Storage) GetGoodByID(key int) (entity.GoodsForList, error) {
 		response.Description = ""
 	}
 
+	response.GoodLabels, err = labels.labels()
+	if err != nil {
+		return response, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return response, nil
+}
+
+// MoveGood moves a good to another project, where it is put last in priority order
+func (s *Storage) MoveGood(id, projectId, newProjectId int) (entity.GoodsForList, error) {
+	const op = "storage.postgres.MoveGood"
+
+	var response entity.GoodsForList
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return response, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	response, err = s.moveGood(tx, id, projectId, newProjectId)
+	if err != nil {
+		return response, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return response, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return response, nil
+}
+
+func (s *Storage) moveGood(tx *sql.Tx, id, projectId, newProjectId int) (entity.GoodsForList, error) {
+	const op = "storage.postgres.moveGood"
+
+	var (
+		response    entity.GoodsForList
+		description sql.NullString
+		labels      labelsScan
+	)
+
+	if err := checkProjectExists(tx, newProjectId); err != nil {
+		return response, err
+	}
+
+	if err := s.checkGoodsQuota(tx, newProjectId); err != nil {
+		return response, err
+	}
+
+	query := `
+		UPDATE goods
+		SET project_id = $3,
+		    priority = (SELECT COALESCE(MAX(priority), 0) + 1 FROM goods WHERE project_id = $3)
+		WHERE id = $1 AND project_id = $2
+		RETURNING id, project_id, name, description, priority, removed, created_at,` + labelColumns("goods") + `;
+		`
+
+	err := tx.QueryRow(query, id, projectId, newProjectId).Scan(
+		&response.Id,
+		&response.ProjectId,
+		&response.Name,
+		&description,
+		&response.Priority,
+		&response.Removed,
+		&response.CreatedAt,
+		&labels.tags,
+		&labels.attributes,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return response, ErrNotFound
+		}
+		return response, fmt.Errorf("%s: %w", op, err)
+	}
+
+	response.Description = description.String
+
+	response.GoodLabels, err = labels.labels()
+	if err != nil {
+		return response, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return response, nil
 }
 
-func (s *Storage) CalculateTotalAndRemoved() (int, int, error) {
-	const op = "storage.postgres.CalculateTotalAndRemoved"
+// ProjectStats returns the goods counters of a project, projectId 0 sums up every project
+func (s *Storage) ProjectStats(projectId int) (entity.ProjectStats, error) {
+	const op = "storage.postgres.ProjectStats"
 
-	var total, removed int
+	stats := entity.ProjectStats{ProjectId: projectId}
 
 	query := `
 	SELECT
-  COUNT(*) AS total_count,
-  COUNT(*) FILTER (WHERE removed = true) AS removed_count
-FROM
-  goods;
+		COALESCE(SUM(total), 0),
+		COALESCE(SUM(active), 0),
+		COALESCE(SUM(removed), 0)
+	FROM project_stats
+	WHERE $1 = 0 OR project_id = $1;
 	`
 
-	err := s.db.QueryRow(query).Scan(&total, &removed)
+	err := s.db.QueryRow(query, projectId).Scan(&stats.Total, &stats.Active, &stats.Removed)
 	if err != nil {
-		return 0, 0, fmt.Errorf("%s: %w", op, err)
+		return stats, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return total, removed, nil
+	return stats, nil
 }
 
-func (s *Storage) Reprioritize(goodID, projectID, newPriority int) (string, string, error) {
+// Reprioritize moves a good to a new priority, shifting the goods in between, and returns its name,
+// description and labels for the event
+func (s *Storage) Reprioritize(goodID, projectID, newPriority int) (string, string, entity.GoodLabels, error) {
 	const op = "storage.postgres.Reprioritize"
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", "", entity.GoodLabels{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	name, description, labels, err := s.reprioritize(tx, goodID, projectID, newPriority)
+	if err != nil {
+		return "", "", labels, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", labels, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return name, description, labels, nil
+}
+
+func (s *Storage) reprioritize(tx *sql.Tx, goodID, projectID, newPriority int) (string, string, entity.GoodLabels, error) {
+	const op = "storage.postgres.reprioritize"
+
 	var (
 		name           string
 		descriptionStr string
 		description    sql.NullString
+		labels         labelsScan
 	)
 
-	tx, err := s.db.Begin()
-	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+	if err := s.checkReprioritizeQuota(tx, projectID); err != nil {
+		return "", "", entity.GoodLabels{}, err
 	}
-	defer tx.Rollback()
 
 	var currentPriority int
 
-	err = tx.QueryRow(`SELECT priority FROM goods WHERE id = $1 AND project_id = $2`, goodID, projectID).Scan(&currentPriority)
+	err := tx.QueryRow(`SELECT priority FROM goods WHERE id = $1 AND project_id = $2`, goodID, projectID).Scan(&currentPriority)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", "", ErrNotFound
+			return "", "", entity.GoodLabels{}, ErrNotFound
 		}
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return "", "", entity.GoodLabels{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var lastPriority int
+
+	err = tx.QueryRow(`SELECT MAX(priority) FROM goods WHERE project_id = $1`, projectID).Scan(&lastPriority)
+	if err != nil {
+		return "", "", entity.GoodLabels{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if newPriority > lastPriority {
+		return "", "", entity.GoodLabels{}, &PriorityRangeError{Max: lastPriority}
 	}
 
 	if newPriority < currentPriority {
@@ -260,16 +538,12 @@ func (s *Storage) Reprioritize(goodID, projectID, newPriority int) (string, stri
 		_, err = tx.Exec(`UPDATE goods SET priority = priority - 1 WHERE project_id = $1 AND priority <= $2 AND priority > $3`, projectID, newPriority, currentPriority)
 	}
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return "", "", entity.GoodLabels{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = tx.QueryRow(`UPDATE goods SET priority = $1 WHERE id = $2 AND project_id = $3 RETURNING name, description`, newPriority, goodID, projectID).Scan(&name, &description)
+	err = tx.QueryRow(`UPDATE goods SET priority = $1 WHERE id = $2 AND project_id = $3 RETURNING name, description,`+labelColumns("goods"), newPriority, goodID, projectID).Scan(&name, &description, &labels.tags, &labels.attributes)
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
-	}
-
-	if err := tx.Commit(); err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return "", "", entity.GoodLabels{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	if description.Valid {
@@ -278,5 +552,161 @@ func (s *Storage) Reprioritize(goodID, projectID, newPriority int) (string, stri
 		descriptionStr = ""
 	}
 
-	return name, descriptionStr, nil
+	goodLabels, err := labels.labels()
+	if err != nil {
+		return "", "", goodLabels, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return name, descriptionStr, goodLabels, nil
+}
+
+// ListAllGoods returns every good of a project ordered by id, projectId 0 means every project
+func (s *Storage) ListAllGoods(projectId int) ([]entity.GoodsForList, error) {
+	const op = "storage.postgres.ListAllGoods"
+
+	query := `
+	SELECT id, project_id, name, description, priority, removed, created_at,` + labelColumns("goods") + `
+	FROM goods
+	WHERE $1 = 0 OR project_id = $1
+	ORDER BY id;
+	`
+
+	rows, err := s.db.Query(query, projectId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var goods []entity.GoodsForList
+	for rows.Next() {
+		var (
+			good        entity.GoodsForList
+			description sql.NullString
+			labels      labelsScan
+		)
+
+		err := rows.Scan(
+			&good.Id,
+			&good.ProjectId,
+			&good.Name,
+			&description,
+			&good.Priority,
+			&good.Removed,
+			&good.CreatedAt,
+			&labels.tags,
+			&labels.attributes,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		good.Description = description.String
+		if good.GoodLabels, err = labels.labels(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		goods = append(goods, good)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return goods, nil
+}
+
+// ListGoodIDs returns the ids of a page of goods ordered by priority, projectId 0 lists every project
+// and a nil removed matches both removed and active goods
+func (s *Storage) ListGoodIDs(projectId int, removed *bool, limit, offset int) ([]int, error) {
+	return s.FilterGoodIDs(projectId, removed, entity.GoodsFilter{}, limit, offset)
+}
+
+// FilterGoodIDs is ListGoodIDs narrowed to the goods matching the filter
+func (s *Storage) FilterGoodIDs(projectId int, removed *bool, filter entity.GoodsFilter, limit, offset int) ([]int, error) {
+	const op = "storage.postgres.FilterGoodIDs"
+
+	conditions, args := filterConditions(filter, []any{projectId, removed, limit, offset})
+
+	query := `
+	SELECT id
+	FROM goods
+	WHERE ($1 = 0 OR project_id = $1)
+	  AND ($2::boolean IS NULL OR removed = $2)
+	  ` + conditions + `
+	ORDER BY project_id, priority, id
+	LIMIT $3 OFFSET $4;
+	`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0, limit)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ids, nil
+}
+
+// GetGoodsByIDs returns the goods with the given ids in a single query, ids that do not exist are skipped
+func (s *Storage) GetGoodsByIDs(ids []int) ([]entity.GoodsForList, error) {
+	const op = "storage.postgres.GetGoodsByIDs"
+
+	query := `
+	SELECT id, project_id, name, description, priority, removed, created_at,` + labelColumns("goods") + `
+	FROM goods
+	WHERE id = ANY($1);
+	`
+
+	rows, err := s.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	goods := make([]entity.GoodsForList, 0, len(ids))
+	for rows.Next() {
+		var (
+			good        entity.GoodsForList
+			description sql.NullString
+			labels      labelsScan
+		)
+
+		err := rows.Scan(
+			&good.Id,
+			&good.ProjectId,
+			&good.Name,
+			&description,
+			&good.Priority,
+			&good.Removed,
+			&good.CreatedAt,
+			&labels.tags,
+			&labels.attributes,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		good.Description = description.String
+		if good.GoodLabels, err = labels.labels(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		goods = append(goods, good)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return goods, nil
 }
@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"hezzl_test/internal/entity"
+)
+
+// ListProjects returns a page of projects ordered by id
+func (s *Storage) ListProjects(limit, offset int) ([]entity.Project, error) {
+	const op = "storage.postgres.ListProjects"
+
+	rows, err := s.db.Query(`SELECT id, name, created_at FROM projects ORDER BY id LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	projects := make([]entity.Project, 0, limit)
+	for rows.Next() {
+		var project entity.Project
+		if err := rows.Scan(&project.Id, &project.Name, &project.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		projects = append(projects, project)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return projects, nil
+}
+
+// GetProjectsByIDs returns the projects with the given ids in a single query, ids that do not exist are skipped
+func (s *Storage) GetProjectsByIDs(ids []int) ([]entity.Project, error) {
+	const op = "storage.postgres.GetProjectsByIDs"
+
+	rows, err := s.db.Query(`SELECT id, name, created_at FROM projects WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	projects := make([]entity.Project, 0, len(ids))
+	for rows.Next() {
+		var project entity.Project
+		if err := rows.Scan(&project.Id, &project.Name, &project.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		projects = append(projects, project)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return projects, nil
+}
+
+// ProjectStatsByIDs returns the goods counters of several projects, projects without goods get zero counters
+func (s *Storage) ProjectStatsByIDs(ids []int) (map[int]entity.ProjectStats, error) {
+	const op = "storage.postgres.ProjectStatsByIDs"
+
+	stats := make(map[int]entity.ProjectStats, len(ids))
+	for _, id := range ids {
+		stats[id] = entity.ProjectStats{ProjectId: id}
+	}
+
+	rows, err := s.db.Query(`SELECT project_id, total, active, removed FROM project_stats WHERE project_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectStats entity.ProjectStats
+		if err := rows.Scan(&projectStats.ProjectId, &projectStats.Total, &projectStats.Active, &projectStats.Removed); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		stats[projectStats.ProjectId] = projectStats
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return stats, nil
+}
+
+// ListGoodIDsByProjects returns the same page of goods ids for each of several projects in one query,
+// ordered by priority like ListGoodIDs
+func (s *Storage) ListGoodIDsByProjects(projectIds []int, removed *bool, limit, offset int) (map[int][]int, error) {
+	const op = "storage.postgres.ListGoodIDsByProjects"
+
+	query := `
+	SELECT project_id, id
+	FROM (
+		SELECT project_id, id, priority,
+		       ROW_NUMBER() OVER (PARTITION BY project_id ORDER BY priority, id) AS position
+		FROM goods
+		WHERE project_id = ANY($1)
+		  AND ($2::boolean IS NULL OR removed = $2)
+	) ranked
+	WHERE position > $4 AND position <= $3 + $4
+	ORDER BY project_id, priority, id;
+	`
+
+	rows, err := s.db.Query(query, pq.Array(projectIds), removed, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	pages := make(map[int][]int, len(projectIds))
+	for _, projectId := range projectIds {
+		pages[projectId] = []int{}
+	}
+
+	for rows.Next() {
+		var projectId, id int
+		if err := rows.Scan(&projectId, &id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		pages[projectId] = append(pages[projectId], id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pages, nil
+}
+
+// checkProjectExists fails with ErrProjectNotFound before a write would hit the foreign key of goods,
+// the project row is locked against deletion until tx ends
+func checkProjectExists(tx *sql.Tx, projectId int) error {
+	const op = "storage.postgres.checkProjectExists"
+
+	var id int
+
+	err := tx.QueryRow(`SELECT id FROM projects WHERE id = $1 FOR KEY SHARE`, projectId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrProjectNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrGoodsQuotaExceeded        = errors.New("project goods quota exceeded")
+	ErrReprioritizeQuotaExceeded = errors.New("project reprioritize quota exceeded")
+)
+
+// Quota limits what a project may do, zero values mean unlimited
+type Quota struct {
+	MaxGoods                  int
+	MaxReprioritizesPerMinute int
+}
+
+// SetQuotas sets the quota of every project and the overrides of single projects,
+// it is meant to be called once before the storage is used
+func (s *Storage) SetQuotas(defaults Quota, projects map[int]Quota) {
+	s.defaultQuota = defaults
+	s.projectQuotas = projects
+}
+
+func (s *Storage) quota(projectId int) Quota {
+	if quota, ok := s.projectQuotas[projectId]; ok {
+		return quota
+	}
+
+	return s.defaultQuota
+}
+
+// checkGoodsQuota locks the counters of the project until tx ends, so concurrent creates
+// cannot both pass the check, and fails if the project has no room for another good
+func (s *Storage) checkGoodsQuota(tx *sql.Tx, projectId int) error {
+	const op = "storage.postgres.checkGoodsQuota"
+
+	maxGoods := s.quota(projectId).MaxGoods
+	if maxGoods <= 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(`INSERT INTO project_stats (project_id) VALUES ($1) ON CONFLICT (project_id) DO NOTHING`, projectId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var active int
+
+	err = tx.QueryRow(`SELECT active FROM project_stats WHERE project_id = $1 FOR UPDATE`, projectId).Scan(&active)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if active >= maxGoods {
+		return ErrGoodsQuotaExceeded
+	}
+
+	return nil
+}
+
+// checkReprioritizeQuota counts the reprioritize in the usage of the current minute and fails
+// once the project is over its quota, the count is rolled back together with tx
+func (s *Storage) checkReprioritizeQuota(tx *sql.Tx, projectId int) error {
+	const op = "storage.postgres.checkReprioritizeQuota"
+
+	maxPerMinute := s.quota(projectId).MaxReprioritizesPerMinute
+	if maxPerMinute <= 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(`DELETE FROM project_quota_usage WHERE project_id = $1 AND minute < date_trunc('minute', NOW())`, projectId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var used int
+
+	err = tx.QueryRow(`
+		INSERT INTO project_quota_usage (project_id, minute, reprioritizes)
+		VALUES ($1, date_trunc('minute', NOW()), 1)
+		ON CONFLICT (project_id, minute) DO UPDATE SET reprioritizes = project_quota_usage.reprioritizes + 1
+		RETURNING reprioritizes;
+		`, projectId).Scan(&used)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if used > maxPerMinute {
+		return ErrReprioritizeQuotaExceeded
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"hezzl_test/internal/entity"
+	"strings"
+)
+
+// Highlighted words are wrapped in these markers, they cannot appear in names typed by users,
+// so callers can escape the text and put their own markup in place of them
+const (
+	HighlightStart = "\x02"
+	HighlightStop  = "\x03"
+)
+
+// SearchGoods returns a page of active goods matching the query, best matches first. Words are matched
+// by their Russian forms and as written, names also match with typos by trigram similarity.
+// projectId 0 searches every project.
+func (s *Storage) SearchGoods(projectId int, query string, limit, offset int) ([]entity.GoodSearchResult, error) {
+	const op = "storage.postgres.SearchGoods"
+
+	sqlQuery := `
+	WITH q AS (
+		SELECT websearch_to_tsquery('russian', $2) || websearch_to_tsquery('simple', $2) AS query
+	)
+	SELECT g.id, g.project_id, g.name, g.description, g.priority, g.removed, g.created_at,` + labelColumns("g") + `,
+	       ts_headline('russian', g.name, q.query, $5) AS name_highlight,
+	       ts_headline('russian', COALESCE(g.description, ''), q.query, $6) AS description_highlight,
+	       ts_rank_cd(g.search_vector, q.query) + word_similarity($2, g.name) AS rank
+	FROM goods g, q
+	WHERE ($1 = 0 OR g.project_id = $1)
+	  AND g.removed = false
+	  AND (g.search_vector @@ q.query OR $2 <% g.name)
+	ORDER BY rank DESC, g.priority, g.id
+	LIMIT $3 OFFSET $4;
+	`
+
+	nameOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", HighlightStart, HighlightStop)
+	descriptionOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=20, MinWords=5", HighlightStart, HighlightStop)
+
+	rows, err := s.db.Query(sqlQuery, projectId, query, limit, offset, nameOptions, descriptionOptions)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	results := make([]entity.GoodSearchResult, 0, limit)
+	for rows.Next() {
+		var (
+			result      entity.GoodSearchResult
+			description sql.NullString
+			labels      labelsScan
+		)
+
+		err := rows.Scan(
+			&result.Id,
+			&result.ProjectId,
+			&result.Name,
+			&description,
+			&result.Priority,
+			&result.Removed,
+			&result.CreatedAt,
+			&labels.tags,
+			&labels.attributes,
+			&result.Highlight.Name,
+			&result.Highlight.Description,
+			&result.Rank,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		result.Description = description.String
+		if result.GoodLabels, err = labels.labels(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return results, nil
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns, backslash is the default escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SuggestGoods returns active goods whose name or a word of it starts with the prefix, or is similar to it
+// when the prefix has a typo. The limit best matches are returned in priority order. projectId 0 searches every project.
+func (s *Storage) SuggestGoods(projectId int, prefix string, limit int) ([]entity.GoodSuggestion, error) {
+	const op = "storage.postgres.SuggestGoods"
+
+	// both patterns and the similarity operator are served by the trigram index on names
+	query := `
+	SELECT id, project_id, name, priority
+	FROM (
+		SELECT id, project_id, name, priority
+		FROM goods
+		WHERE ($1 = 0 OR project_id = $1)
+		  AND removed = false
+		  AND (name ILIKE $2 OR name ILIKE $3 OR $4 <% name)
+		ORDER BY name ILIKE $2 DESC, word_similarity($4, name) DESC, priority
+		LIMIT $5
+	) best
+	ORDER BY priority, id;
+	`
+
+	escaped := likeEscaper.Replace(prefix)
+
+	rows, err := s.db.Query(query, projectId, escaped+"%", "% "+escaped+"%", prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	suggestions := make([]entity.GoodSuggestion, 0, limit)
+	for rows.Next() {
+		var suggestion entity.GoodSuggestion
+		if err := rows.Scan(&suggestion.Id, &suggestion.ProjectId, &suggestion.Name, &suggestion.Priority); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,248 @@
+package warmup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hezzl_test/internal/cache"
+	"hezzl_test/internal/entity"
+	"sync"
+	"time"
+)
+
+var ErrRunning = errors.New("warm-up is already running")
+
+type Goods interface {
+	ListGoodIDs(projectId int, removed *bool, limit, offset int) ([]int, error)
+	GetGoodsByIDs(ids []int) ([]entity.GoodsForList, error)
+	ProjectStats(projectId int) (entity.ProjectStats, error)
+}
+
+// Options says what to preload: the first Pages pages of PageSize goods of every project,
+// at most Concurrency projects at a time
+type Options struct {
+	Projects    []int
+	Pages       int
+	PageSize    int
+	Concurrency int
+}
+
+// Progress of a warm-up, Done counts finished projects including the Failed ones
+type Progress struct {
+	Projects int `json:"projects"`
+	Done     int `json:"done"`
+	Failed   int `json:"failed"`
+	Pages    int `json:"pages"`
+	Goods    int `json:"goods"`
+}
+
+// Warmer fills the list cache the same way GET /goods/list does, so the entries it writes are
+// the ones the first requests after a Redis flush or a deploy look for
+type Warmer struct {
+	goods  Goods
+	cache  cache.Cache
+	loader *cache.Loader
+}
+
+func New(goods Goods, c cache.Cache) *Warmer {
+	return &Warmer{
+		goods:  goods,
+		cache:  c,
+		loader: cache.NewLoader(c),
+	}
+}
+
+// Run warms every project up and calls report after each of them. A failed project does not stop
+// the others, the returned error is the first failure.
+func (w *Warmer) Run(ctx context.Context, opts Options, report func(Progress)) (Progress, error) {
+	const op = "warmup.Run"
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		progress = Progress{Projects: len(opts.Projects)}
+		sem      = make(chan struct{}, concurrency)
+	)
+
+	for _, projectId := range opts.Projects {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return progress, fmt.Errorf("%s: %w", op, ctx.Err())
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(projectId int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			pages, goods, err := w.warmProject(ctx, projectId, opts.Pages, opts.PageSize)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			progress.Done++
+			progress.Pages += pages
+			progress.Goods += goods
+			if err != nil {
+				progress.Failed++
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: project %d: %w", op, projectId, err)
+				}
+			}
+
+			if report != nil {
+				report(progress)
+			}
+		}(projectId)
+	}
+
+	wg.Wait()
+
+	return progress, firstErr
+}
+
+// warmProject stores the counters, the first pages and their goods of a project under its current generation
+func (w *Warmer) warmProject(ctx context.Context, projectId, pages, pageSize int) (int, int, error) {
+	const op = "warmup.warmProject"
+
+	generation, err := cache.Generation(ctx, w.cache, projectId)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	stats, err := w.goods.ProjectStats(projectId)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	statsData, _ := json.Marshal(stats)
+	if err := w.cache.Set(ctx, cache.StatsKey(projectId, generation), statsData, cache.PageTTL); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	warmedPages, warmedGoods := 0, 0
+
+	for page := 0; page < pages; page++ {
+		offset := page * pageSize
+
+		pageKey := cache.PageKey(projectId, generation, "all", pageSize, offset)
+		data, err := w.loader.Refresh(ctx, pageKey, cache.PageTTL, func(ctx context.Context) ([]byte, error) {
+			ids, err := w.goods.ListGoodIDs(projectId, nil, pageSize, offset)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(ids)
+		})
+		if err != nil {
+			return warmedPages, warmedGoods, fmt.Errorf("%s: %w", op, err)
+		}
+
+		var ids []int
+		if err := json.Unmarshal(data, &ids); err != nil {
+			return warmedPages, warmedGoods, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if len(ids) == 0 {
+			break
+		}
+
+		goodsList, err := w.goods.GetGoodsByIDs(ids)
+		if err != nil {
+			return warmedPages, warmedGoods, fmt.Errorf("%s: %w", op, err)
+		}
+
+		items := make(map[string][]byte, len(goodsList))
+		for _, good := range goodsList {
+			jsonData, _ := json.Marshal(good)
+			items[cache.GoodKey(projectId, generation, good.Id)] = jsonData
+		}
+		if err := w.cache.MSet(ctx, items, cache.GoodTTL); err != nil {
+			return warmedPages, warmedGoods, fmt.Errorf("%s: %w", op, err)
+		}
+
+		warmedPages++
+		warmedGoods += len(goodsList)
+
+		if len(ids) < pageSize {
+			break
+		}
+	}
+
+	return warmedPages, warmedGoods, nil
+}
+
+// Status of the last warm-up started through a Job
+type Status struct {
+	Running    bool       `json:"running"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Progress   Progress   `json:"progress"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Job runs one warm-up at a time in the background and keeps its progress for status requests
+type Job struct {
+	warmer *Warmer
+
+	mu     sync.Mutex
+	status Status
+}
+
+func NewJob(warmer *Warmer) *Job {
+	return &Job{warmer: warmer}
+}
+
+// Start begins a warm-up unless one is already running
+func (j *Job) Start(opts Options) (Status, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.status.Running {
+		return j.status, ErrRunning
+	}
+
+	startedAt := time.Now()
+	j.status = Status{
+		Running:   true,
+		StartedAt: &startedAt,
+		Progress:  Progress{Projects: len(opts.Projects)},
+	}
+
+	go func() {
+		// the warm-up outlives the request that started it
+		progress, err := j.warmer.Run(context.Background(), opts, func(progress Progress) {
+			j.mu.Lock()
+			j.status.Progress = progress
+			j.mu.Unlock()
+		})
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+
+		finishedAt := time.Now()
+		j.status.Running = false
+		j.status.FinishedAt = &finishedAt
+		j.status.Progress = progress
+		if err != nil {
+			j.status.Error = err.Error()
+		}
+	}()
+
+	return j.status, nil
+}
+
+func (j *Job) Status() Status {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.status
+}